@@ -0,0 +1,56 @@
+package etc
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/aymerick/raymond"
+	"github.com/nektro/go.etc/htp"
+	"github.com/nektro/go.etc/htp/middleware"
+)
+
+// errorPage is used when the theme does not have an /errors/ template
+const errorPage = `<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>{{status}} {{title}}</title>
+</head>
+<body>
+	<h1>{{status}} {{title}}</h1>
+	<p>{{message}}</p>
+	{{#if request_id}}<p><small>Request ID: {{request_id}}</small></p>{{/if}}
+</body>
+</html>
+`
+
+// RenderError is the default htp error handler, used when HtpErrCb is nil. API
+// clients get RFC 7807 problem details JSON. Browsers get the first of
+// '/errors/<status>.hbs' or '/errors/error.hbs' found in MFS, or a plain page.
+func RenderError(w http.ResponseWriter, r *http.Request, err *htp.HTTPError) {
+	if !htp.WantsHTML(r) {
+		htp.WriteProblem(w, r, err)
+		return
+	}
+	context := map[string]interface{}{
+		"status":     err.Status,
+		"title":      http.StatusText(err.Status),
+		"message":    err.Message,
+		"details":    err.Details,
+		"request_id": middleware.GetRequestID(r),
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	for _, item := range []string{"/errors/" + strconv.Itoa(err.Status) + ".hbs", "/errors/error.hbs"} {
+		f, ferr := MFS.Open(item)
+		if ferr != nil {
+			continue
+		}
+		f.Close()
+		w.WriteHeader(err.Status)
+		WriteHandlebarsFile(r, w, item, context)
+		return
+	}
+	result, _ := raymond.Render(errorPage, context)
+	w.WriteHeader(err.Status)
+	w.Write([]byte(result))
+}
@@ -9,7 +9,6 @@ import (
 	"path/filepath"
 	"reflect"
 	"runtime"
-	"strconv"
 	"strings"
 
 	"github.com/aymerick/raymond"
@@ -22,6 +21,7 @@ import (
 	"github.com/nektro/go.etc/htp"
 	"github.com/nektro/go.etc/internal"
 	"github.com/nektro/go.etc/jwt"
+	kvstore "github.com/nektro/go.etc/store"
 	oauth2 "github.com/nektro/go.oauth2"
 	"github.com/rakyll/statik/fs"
 
@@ -39,7 +39,7 @@ var (
 	Bind       string
 	Port       int
 	Epoch      = internal.Epoch
-	HtpErrCb   = func(r *http.Request, w http.ResponseWriter, good bool, status int, message string) {}
+	HtpErrCb   func(r *http.Request, w http.ResponseWriter, good bool, status int, message string) // nil uses RenderError
 )
 
 var (
@@ -48,12 +48,16 @@ var (
 	homedirV, _  = homedir.Dir()
 )
 
+func init() {
+	raymond.RegisterHelper("csrf_field", helperCSRFField)
+}
+
 // PreInit registers and parses application flags
 func PreInit() {
 	vflag.StringArrayVar(&appFlagTheme, "theme", []string{}, "A CLI way to add config themes.")
 	vflag.StringVar(&ConfigPath, "config", homedirV+"/.config/"+AppID+"/config.json", "")
 	vflag.StringVar(&JWTSecret, "jwt-secret", util.RandomString(64), "Private secret to sign and verify JWT auth tokens with.")
-	vflag.StringVar(&Bind, "bind", "0.0.0.0", "IP to bind")
+	vflag.StringVar(&Bind, "bind", "0.0.0.0", "IP to bind, or 'unix:/path/to.sock' to listen on a unix socket.")
 	vflag.IntVar(&Port, "port", 8000, "The port to bind the web server to.")
 	htp.PreInit()
 
@@ -72,8 +76,27 @@ func Init(config interface{}, doneURL string, saveOA2Info oauth2.SaveInfoFunc) {
 	if !util.DoesFileExist(ConfigPath) {
 		ioutil.WriteFile(ConfigPath, []byte("{\n}\n"), os.ModePerm)
 	}
+	v := reflect.ValueOf(config).Elem().Elem()
+	t := v.Type()
+
+	// filled in before the config is read so that it only needs the values it changes
+	sh, hasSH := t.FieldByName("SecurityHeaders")
+	if hasSH {
+		v.FieldByName(sh.Name).Set(reflect.ValueOf(htp.Headers))
+	}
+	lm, hasLM := t.FieldByName("Limits")
+	if hasLM {
+		v.FieldByName(lm.Name).Set(reflect.ValueOf(htp.Limits))
+	}
 	InitConfig(ConfigPath, &config)
+	if hasLM {
+		htp.Limits = v.FieldByName(lm.Name).Interface().(htp.LimitsConfig)
+	}
+	// parsed again so that flags override the config
 	vflag.Parse()
+	if hasSH {
+		htp.Headers = v.FieldByName(sh.Name).Interface().(htp.SecurityHeaders)
+	}
 
 	//
 	db, err := connectDB()
@@ -82,12 +105,21 @@ func Init(config interface{}, doneURL string, saveOA2Info oauth2.SaveInfoFunc) {
 	Database = db
 
 	//
+	if len(htp.TLS.ACMECache) == 0 {
+		htp.TLS.ACMECache = dRoot + "/acme"
+	}
+	htp.Version = Version
+	htp.Name = AppID
+	if len(htp.Tracing.ServiceName) == 0 {
+		htp.Tracing.ServiceName = AppID
+	}
 	htp.Init()
+	htp.OnShutdown(kvstore.Close)
+	htp.OnShutdown(Database.Close)
+	htp.AddReadyCheck("db", Database.Ping)
+	htp.AddReadyCheck("store", kvstore.Ping)
 
 	//
-	v := reflect.ValueOf(config).Elem().Elem()
-	t := v.Type()
-
 	f, ok := t.FieldByName("Themes")
 	if ok {
 		themes := []string{}
@@ -132,10 +164,16 @@ func Init(config interface{}, doneURL string, saveOA2Info oauth2.SaveInfoFunc) {
 		v.FieldByName(f.Name).Set(reflect.ValueOf(clients))
 	}
 
-	htp.ErrorHandleFunc = func(w http.ResponseWriter, r *http.Request, data string) {
-		code, _ := strconv.Atoi(data[:3])
-		good := !(code >= 400)
-		HtpErrCb(r, w, good, int(code), data[5:])
+	htp.ErrorHandleFunc = func(w http.ResponseWriter, r *http.Request, err *htp.HTTPError) {
+		if err.Err != nil {
+			util.LogError("htp:", r.Method, r.URL.Path, err.Err)
+		}
+		if HtpErrCb == nil {
+			RenderError(w, r, err)
+			return
+		}
+		good := !(err.Status >= 400)
+		HtpErrCb(r, w, good, err.Status, err.Message)
 	}
 }
 
@@ -170,16 +208,35 @@ func WriteHandlebarsFile(r *http.Request, w http.ResponseWriter, path string, co
 		}
 		context["languages"] = strings.Join(arr, ",")
 	}
+	context["csrf_token"] = htp.CSRFToken(r)
+	context["csp_nonce"] = htp.CSPNonce(r)
 	reader, _ := MFS.Open(path)
 	bytes, _ := ioutil.ReadAll(reader)
-	template := string(bytes)
-	result, _ := raymond.Render(template, context)
+	template, err := raymond.Parse(string(bytes))
+	if err != nil {
+		util.LogError("handlebars:", path, err)
+		return
+	}
+	// private data is visible inside nested blocks as well, as in {{@csp_nonce}}
+	data := raymond.NewDataFrame()
+	data.Set("csrf_token", context["csrf_token"])
+	data.Set("csp_nonce", context["csp_nonce"])
+	result, _ := template.ExecWith(context, data)
 	fmt.Fprintln(w, result)
 }
 
+// helperCSRFField is the {{csrf_field}} handlebars helper, which adds the CSRF token to a form
+func helperCSRFField(options *raymond.Options) raymond.SafeString {
+	token := options.DataStr("csrf_token")
+	if len(token) == 0 {
+		return ""
+	}
+	return raymond.SafeString(`<input type="hidden" name="` + htp.CSRFFieldName + `" value="` + raymond.Escape(token) + `">`)
+}
+
 func StartServer() {
 	htp.RegisterFileSystem(MFS)
-	htp.StartServer(Bind, Port)
+	util.DieOnError(htp.StartServer(Bind, Port))
 }
 
 // FixBareVersion will convert a 'vMASTER' version string to a string
@@ -198,4 +255,6 @@ func FixBareVersion() {
 		}
 	}
 	Version += "-" + runtime.Version()
+	htp.Version = Version
+	htp.Name = AppID
 }
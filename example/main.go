@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
@@ -13,9 +12,11 @@ import (
 )
 
 type configT struct {
-	Clients   []oauth2.AppConf  `json:"clients"`
-	Providers []oauth2.Provider `json:"providers"`
-	Themes    []string          `json:"themes"`
+	Clients         []oauth2.AppConf    `json:"clients"`
+	Providers       []oauth2.Provider   `json:"providers"`
+	Themes          []string            `json:"themes"`
+	SecurityHeaders htp.SecurityHeaders `json:"security_headers"`
+	Limits          htp.LimitsConfig    `json:"limits"`
 }
 
 var (
@@ -31,16 +32,6 @@ func main() {
 		etc.JWTSet(w, provider+"\n"+id)
 	})
 
-	etc.HtpErrCb = func(r *http.Request, w http.ResponseWriter, good bool, code int, message string) {
-		resp := map[string]interface{}{
-			"success": good,
-			"message": message,
-		}
-		w.Header().Add("content-type", "application/json")
-		dat, _ := json.Marshal(resp)
-		fmt.Fprintln(w, string(dat))
-	}
-
 	htp.Register("/dashboard", http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
 		c := htp.GetController(r)
 		l := etc.JWTGetClaims(c, r)
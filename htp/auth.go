@@ -0,0 +1,35 @@
+package htp
+
+import (
+	"net/http"
+
+	"github.com/nektro/go.etc/htp/middleware"
+	"github.com/nektro/go.etc/jwt"
+)
+
+// RequireJWT rejects requests that do not carry a JWT signed with secret, in the
+// Authorization header, 'jwt' cookie, or 'jwt' query value. The claims of
+// accepted requests are available from JWTClaims.
+func RequireJWT(secret string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if c, ok := r.Context().Value(ctxKeyController).(*Controller); ok && c.route != nil {
+				c.route.setAuth()
+			}
+			claims, err := jwt.VerifyRequest(r, secret)
+			if err != nil {
+				HandleError(w, r, NewError(http.StatusForbidden, err.Error()))
+				return
+			}
+			sub, _ := claims["sub"].(string)
+			middleware.SetSubject(r, sub)
+			next.ServeHTTP(w, withValue(r, ctxKeyJWT, claims))
+		})
+	}
+}
+
+// JWTClaims returns the claims accepted by RequireJWT, or nil if it was not used
+func JWTClaims(r *http.Request) jwt.MapClaims {
+	c, _ := r.Context().Value(ctxKeyJWT).(jwt.MapClaims)
+	return c
+}
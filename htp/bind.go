@@ -0,0 +1,51 @@
+package htp
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// MaxJSONBytes is the largest request body BindJSON will accept
+var MaxJSONBytes int64 = 1 << 20
+
+// BindJSON decodes the request body into v and runs Validate on it. Unknown
+// fields, bodies over MaxJSONBytes, and failed validation exit this http method.
+// The request must have a JSON Content-Type, and pass AssertCSRF if CSRF is enabled.
+func (v *Controller) BindJSON(dst interface{}) {
+	if v.route != nil {
+		v.route.setRequestBody(dst)
+	}
+	// a missing type is refused too, as a cross-site request may send a body without one
+	mt, _, _ := mime.ParseMediaType(v.r.Header.Get("Content-Type"))
+	v.AssertStatus(mt == "application/json" || strings.HasSuffix(mt, "+json"), http.StatusUnsupportedMediaType, "content type must be application/json")
+	v.AssertCSRF()
+	dec := json.NewDecoder(http.MaxBytesReader(nil, v.r.Body, MaxJSONBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		v.Abort(jsonError(err))
+	}
+	if dec.More() {
+		v.Abort(NewError(http.StatusBadRequest, "invalid json body: unexpected data after top-level value"))
+	}
+	if err := Validate(dst); err != nil {
+		var fe FieldErrors
+		if errors.As(err, &fe) {
+			v.Abort(NewError(http.StatusBadRequest, fe.Error()).WithDetail("fields", fe.Map()))
+		}
+		v.Abort(err)
+	}
+}
+
+func jsonError(err error) *HTTPError {
+	if he := bodyError(err); he != nil {
+		return he
+	}
+	if errors.Is(err, io.EOF) {
+		return WrapError(http.StatusBadRequest, "missing json body", err)
+	}
+	return WrapError(http.StatusBadRequest, "invalid json body: "+strings.TrimPrefix(err.Error(), "json: "), err)
+}
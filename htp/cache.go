@@ -0,0 +1,347 @@
+package htp
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nektro/go.etc/store"
+)
+
+// ETag sets the ETag header of the response, quoting etag if it is not already.
+// If the client has this version, a GET or HEAD is exited with a 304 and any
+// other method with a 412.
+func (v *Controller) ETag(w http.ResponseWriter, etag string) {
+	if !strings.HasSuffix(etag, `"`) {
+		etag = `"` + etag + `"`
+	}
+	w.Header().Set("ETag", etag)
+	if !etagMatch(v.r.Header.Get("If-None-Match"), etag) {
+		return
+	}
+	if v.r.Method == http.MethodGet || v.r.Method == http.MethodHead {
+		v.Abort(NewError(http.StatusNotModified, "not modified"))
+	}
+	v.Abort(NewError(http.StatusPreconditionFailed, "precondition failed"))
+}
+
+// LastModified sets the Last-Modified header of the response. If the client has
+// a copy at least this new, a GET or HEAD is exited with a 304. Pass t.V() for a
+// dbt.Time. Times before 1970, such as an empty dbt.Time, are ignored.
+func (v *Controller) LastModified(w http.ResponseWriter, t time.Time) {
+	if t.Unix() <= 0 {
+		return
+	}
+	t = t.UTC().Truncate(time.Second)
+	w.Header().Set("Last-Modified", t.Format(http.TimeFormat))
+	if v.r.Method != http.MethodGet && v.r.Method != http.MethodHead {
+		return
+	}
+	if !modifiedSince(v.r, t) {
+		v.Abort(NewError(http.StatusNotModified, "not modified"))
+	}
+}
+
+// HashETag returns a strong ETag made from the hash of b
+func HashETag(b []byte) string {
+	hash := sha256.Sum256(b)
+	return `"` + hex.EncodeToString(hash[:16]) + `"`
+}
+
+// etagMatch returns true if etag is in the If-None-Match list. Comparison is
+// weak since Compress marks the ETags of the responses it encodes as weak.
+func etagMatch(list, etag string) bool {
+	if len(list) == 0 || len(etag) == 0 {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "*" || strings.TrimPrefix(item, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// modifiedSince returns false if the client's copy is at least as new as t.
+// If-Modified-Since is ignored when the request has If-None-Match.
+func modifiedSince(r *http.Request, t time.Time) bool {
+	if len(r.Header.Get("If-None-Match")) > 0 {
+		return true
+	}
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return true
+	}
+	return t.After(ims)
+}
+
+// CacheOptions configures Cache
+type CacheOptions struct {
+	Name       string        // separates the entries of caches that share a Store
+	TTL        time.Duration // how long a response is kept
+	Vary       []string      // request headers that get their own copy of a response, such as Authorization
+	Store      store.Inner   // where responses are kept if it supports store.Expirer, defaults to store.This
+	MaxEntries int           // responses kept when they are in memory, defaults to 1000
+}
+
+// Cache keeps the 200 responses of GET requests for TTL, keyed by host, path,
+// query, and the Vary headers, and sends them to later GET and HEAD requests
+// without running the handler. Responses that set a cookie, stream, or have
+// 'Cache-Control: no-store' or 'private' are not kept. Cached responses get an
+// ETag if they have none, so that clients may revalidate them for a 304.
+//
+// Responses are kept in memory, dropping the least recently used past MaxEntries,
+// unless Store can expire keys, as the redis store can.
+//
+// Only the headers set by the handler are kept, so that those of earlier
+// middleware such as RateLimit are fresh on every request. Pages with per-user
+// content, such as a csrf_field, must name the header it depends on in Vary.
+func Cache(opts CacheOptions) Middleware {
+	if opts.TTL <= 0 {
+		panic("htp: cache: TTL must be positive")
+	}
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = 1000
+	}
+	c := &responseCache{opts: opts, mem: newMemCache(opts.MaxEntries)}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			for _, item := range opts.Vary {
+				w.Header().Add("Vary", item)
+			}
+			key := c.key(r)
+			if e, ok := c.get(key); ok {
+				e.send(w, r)
+				return
+			}
+			if r.Method != http.MethodGet {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cw := &cacheWriter{ResponseWriter: w, before: w.Header().Clone()}
+			w.Header().Set("X-Cache", "MISS")
+			next.ServeHTTP(cw, r)
+			if cw.status == http.StatusOK && !cw.streamed && storable(cw.header) {
+				c.set(key, cw)
+			}
+		})
+	}
+}
+
+type responseCache struct {
+	opts  CacheOptions
+	once  sync.Once
+	store store.Inner
+	mem   *memCache
+}
+
+type cacheEntry struct {
+	Time   int64       `json:"time"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+func (c *responseCache) key(r *http.Request) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Host + "\n" + r.URL.Path + "?" + r.URL.RawQuery))
+	for _, item := range c.opts.Vary {
+		hash.Write([]byte("\n" + item + ": " + strings.Join(r.Header.Values(item), ", ")))
+	}
+	return "htp:cache:" + c.opts.Name + ":" + hex.EncodeToString(hash.Sum(nil))
+}
+
+// getStore returns the store that responses are kept in, or nil to keep them in memory
+func (c *responseCache) getStore() store.Inner {
+	c.once.Do(func() {
+		s := c.opts.Store
+		if s == nil && store.This != nil {
+			s = store.This
+		}
+		if _, ok := innerStore(s).(store.Expirer); ok {
+			c.store = s
+		}
+	})
+	return c.store
+}
+
+func (c *responseCache) get(key string) (*cacheEntry, bool) {
+	s := c.getStore()
+	if s == nil {
+		return c.mem.get(key, c.opts.TTL)
+	}
+	v := s.Get(key)
+	if len(v) == 0 {
+		return nil, false
+	}
+	e := new(cacheEntry)
+	if err := json.Unmarshal([]byte(v), e); err != nil || time.Since(time.Unix(0, e.Time)) > c.opts.TTL {
+		return nil, false
+	}
+	return e, true
+}
+
+func (c *responseCache) set(key string, cw *cacheWriter) {
+	body := cw.body.Bytes()
+	if cw.header.Get("Content-Type") == "" {
+		cw.header.Set("Content-Type", http.DetectContentType(body))
+	}
+	if cw.header.Get("ETag") == "" {
+		cw.header.Set("ETag", HashETag(body))
+	}
+	e := &cacheEntry{time.Now().UnixNano(), cw.header, body}
+	s := c.getStore()
+	if s == nil {
+		c.mem.set(key, e)
+		return
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	innerStore(s).(store.Expirer).SetExpire(key, string(b), c.opts.TTL)
+}
+
+// memCache keeps the most recently used responses of a Cache in memory
+type memCache struct {
+	max   int
+	mtx   sync.Mutex
+	order *list.List // of *memItem, most recently used first
+	items map[string]*list.Element
+}
+
+type memItem struct {
+	key   string
+	entry *cacheEntry
+}
+
+func newMemCache(max int) *memCache {
+	return &memCache{max: max, order: list.New(), items: map[string]*list.Element{}}
+}
+
+func (m *memCache) get(key string, ttl time.Duration) (*cacheEntry, bool) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	el, ok := m.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*memItem).entry
+	if time.Since(time.Unix(0, e.Time)) > ttl {
+		m.order.Remove(el)
+		delete(m.items, key)
+		return nil, false
+	}
+	m.order.MoveToFront(el)
+	return e, true
+}
+
+func (m *memCache) set(key string, e *cacheEntry) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if el, ok := m.items[key]; ok {
+		el.Value.(*memItem).entry = e
+		m.order.MoveToFront(el)
+		return
+	}
+	m.items[key] = m.order.PushFront(&memItem{key, e})
+	for m.order.Len() > m.max {
+		el := m.order.Back()
+		m.order.Remove(el)
+		delete(m.items, el.Value.(*memItem).key)
+	}
+}
+
+// send writes this entry to w, or a 304 if the client already has it
+func (e *cacheEntry) send(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	for k, v := range e.Header {
+		// copied as the entry may be in memory and sent to other requests at once
+		h[k] = append([]string{}, v...)
+	}
+	h.Set("X-Cache", "HIT")
+	h.Set("Age", strconv.Itoa(int(time.Since(time.Unix(0, e.Time)).Seconds())))
+	if etagMatch(r.Header.Get("If-None-Match"), h.Get("ETag")) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if t, err := http.ParseTime(h.Get("Last-Modified")); err == nil && !modifiedSince(r, t) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	h.Set("Content-Length", strconv.Itoa(len(e.Body)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(e.Body)
+	}
+}
+
+// storable returns false for responses that must not be shared between clients
+func storable(h http.Header) bool {
+	if len(h.Values("Set-Cookie")) > 0 {
+		return false
+	}
+	cc := strings.ToLower(h.Get("Cache-Control"))
+	return !strings.Contains(cc, "no-store") && !strings.Contains(cc, "private")
+}
+
+// cacheWriter keeps a copy of the response that the handler sends through it
+type cacheWriter struct {
+	http.ResponseWriter
+	before   http.Header
+	header   http.Header
+	status   int
+	body     bytes.Buffer
+	streamed bool
+}
+
+// start records status and the headers the handler changed since before
+func (w *cacheWriter) start(status int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = status
+	w.header = http.Header{}
+	for k, v := range w.Header() {
+		if k == "X-Cache" || strings.Join(w.before[k], "\n") == strings.Join(v, "\n") {
+			continue
+		}
+		w.header[k] = append([]string{}, v...)
+	}
+}
+
+func (w *cacheWriter) WriteHeader(status int) {
+	w.start(status)
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *cacheWriter) Write(b []byte) (int, error) {
+	// the status is not sent here so that the writer below may still sniff the Content-Type
+	w.start(http.StatusOK)
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *cacheWriter) Flush() {
+	w.streamed = true
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.start(http.StatusOK)
+		f.Flush()
+	}
+}
+
+func (w *cacheWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,135 @@
+package htp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestETagMatch(t *testing.T) {
+	cases := []struct {
+		list, etag string
+		want       bool
+	}{
+		{`"a"`, `"a"`, true},
+		{`"b"`, `"a"`, false},
+		{`"b", "a"`, `"a"`, true},
+		{`"b","a"`, `"a"`, true},
+		{`W/"a"`, `"a"`, true},
+		{`"a"`, `W/"a"`, true},
+		{`*`, `"a"`, true},
+		{``, `"a"`, false},
+		{`"a"`, ``, false},
+		{`a`, `"a"`, false},
+	}
+	for _, tc := range cases {
+		if got := etagMatch(tc.list, tc.etag); got != tc.want {
+			t.Errorf("etagMatch(%q, %q) = %v, want %v", tc.list, tc.etag, got, tc.want)
+		}
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	mod := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	s, err := New(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, method := range []string{http.MethodGet, http.MethodPut} {
+		s.RegisterE("/item", method, func(c *Controller, w http.ResponseWriter, r *http.Request) error {
+			c.ETag(w, "v1")
+			c.LastModified(w, mod)
+			io.WriteString(w, "item")
+			return nil
+		})
+	}
+	h := s.Handler()
+	cases := []struct {
+		name   string
+		method string
+		header string
+		value  string
+		status int
+	}{
+		{"no condition", http.MethodGet, "", "", http.StatusOK},
+		{"etag matches", http.MethodGet, "If-None-Match", `"v1"`, http.StatusNotModified},
+		{"weak etag matches", http.MethodGet, "If-None-Match", `W/"v1"`, http.StatusNotModified},
+		{"etag differs", http.MethodGet, "If-None-Match", `"v0"`, http.StatusOK},
+		{"not modified since", http.MethodGet, "If-Modified-Since", mod.Format(http.TimeFormat), http.StatusNotModified},
+		{"modified since", http.MethodGet, "If-Modified-Since", mod.Add(-time.Second).Format(http.TimeFormat), http.StatusOK},
+		{"invalid date", http.MethodGet, "If-Modified-Since", "yesterday", http.StatusOK},
+		{"unsafe method with matching etag", http.MethodPut, "If-None-Match", `*`, http.StatusPreconditionFailed},
+		{"unsafe method ignores dates", http.MethodPut, "If-Modified-Since", mod.Format(http.TimeFormat), http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, "/item", nil)
+			if len(tc.header) > 0 {
+				r.Header.Set(tc.header, tc.value)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+			if rec.Code != tc.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tc.status)
+			}
+			if rec.Header().Get("ETag") != `"v1"` {
+				t.Errorf("headers = %v, want the ETag", rec.Header())
+			}
+			if rec.Code == http.StatusNotModified && rec.Body.Len() > 0 {
+				t.Errorf("304 has a body: %q", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestCache(t *testing.T) {
+	s, err := New(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := 0
+	g := s.Group("/c", Cache(CacheOptions{TTL: time.Minute, Vary: []string{"Authorization"}, MaxEntries: 2}))
+	g.Register("/x", http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		io.WriteString(w, "user "+r.Header.Get("Authorization"))
+	})
+	h := s.Handler()
+	get := func(path, auth, inm string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if len(auth) > 0 {
+			r.Header.Set("Authorization", auth)
+		}
+		if len(inm) > 0 {
+			r.Header.Set("If-None-Match", inm)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+	cases := []struct {
+		path, auth string
+		cache      string
+		body       string
+		calls      int
+	}{
+		{"/c/x", "a", "MISS", "user a", 1},
+		{"/c/x", "a", "HIT", "user a", 1},
+		{"/c/x", "b", "MISS", "user b", 2},
+		{"/c/x?q=1", "a", "MISS", "user a", 3},
+		// the oldest entry was dropped past MaxEntries
+		{"/c/x", "a", "MISS", "user a", 4},
+		{"/c/x?q=1", "a", "HIT", "user a", 4},
+	}
+	for i, tc := range cases {
+		rec := get(tc.path, tc.auth, "")
+		if rec.Header().Get("X-Cache") != tc.cache || rec.Body.String() != tc.body || calls != tc.calls {
+			t.Errorf("%d: got %s %q after %d calls, want %s %q after %d", i, rec.Header().Get("X-Cache"), rec.Body.String(), calls, tc.cache, tc.body, tc.calls)
+		}
+	}
+	etag := get("/c/x?q=1", "a", "").Header().Get("ETag")
+	if rec := get("/c/x?q=1", "a", etag); rec.Code != http.StatusNotModified {
+		t.Errorf("revalidating a cached response: status = %d, want 304", rec.Code)
+	}
+}
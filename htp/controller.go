@@ -1,52 +1,70 @@
 package htp
 
 import (
-	"fmt"
+	"errors"
 	"net/http"
-	"strconv"
 )
 
 // Controller is the htp package's extension
 type Controller struct {
-	r *http.Request
+	r           *http.Request
+	csrfChecked bool
+	route       *routeInfo
 }
 
-// panic tests condition and panics if not met
-func (v *Controller) panic(t string, b bool, d string) {
-	if !b {
-		panic("htp: " + t + ": " + d)
-	}
+// Abort exits this http method with err. A non-HTTPError is sent as a 500.
+func (v *Controller) Abort(err error) {
+	panic(AsHTTPError(err))
 }
 
-// Assert will exit this http method if condition is not met
+// Assert will exit this http method if condition is not met. message may be
+// prefixed with a status code, as in "403: not allowed", else 400 is used.
 func (v *Controller) Assert(condition bool, message string) {
-	v.panic("assertion failed", condition, message)
+	if !condition {
+		status, msg := parseMessage(message)
+		v.Abort(NewError(status, msg))
+	}
+}
+
+// AssertStatus will exit this http method with status if condition is not met
+func (v *Controller) AssertStatus(condition bool, status int, message string) {
+	if !condition {
+		v.Abort(NewError(status, message))
+	}
 }
 
 // RedirectIf will redirct to location if condition is met
 func (v *Controller) RedirectIf(condition bool, location string) {
-	v.panic("redirect", !condition, location)
+	if condition {
+		v.Abort(NewError(http.StatusFound, location))
+	}
 }
 
+// GetQueryString returns the query value name
 func (v *Controller) GetQueryString(name string) string {
-	s := v.r.URL.Query().Get(name)
-	v.Assert(len(s) > 0, "400: missing query value: "+name)
-	return s
+	return v.mustParam(srcQuery, name)
 }
 
+// GetFormString returns the form value name
 func (v *Controller) GetFormString(name string) string {
-	s := v.r.Form.Get(name)
-	v.Assert(len(s) > 0, "400: missing form value: "+name)
-	return s
+	return v.mustParam(srcForm, name)
 }
 
+// GetFormInt returns the form value name and its value as a number
 func (v *Controller) GetFormInt(name string) (string, int64) {
 	s := v.GetFormString(name)
-	n, err := strconv.ParseInt(s, 10, 64)
-	v.Assert(err == nil, "400: form value must be a number: "+name)
-	return s, n
+	return s, v.parseInt(srcForm, name, s)
 }
 
+// AssertNilErr will exit this http method if err is not nil. HTTPErrors are
+// passed through as is, any other error is sent as a 400.
 func (v *Controller) AssertNilErr(err error) {
-	v.Assert(err == nil, "400: "+fmt.Sprintf("%v", err))
+	if err == nil {
+		return
+	}
+	var he *HTTPError
+	if !errors.As(err, &he) {
+		he = WrapError(http.StatusBadRequest, err.Error(), err)
+	}
+	v.Abort(he)
 }
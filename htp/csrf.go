@@ -0,0 +1,117 @@
+package htp
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/nektro/go-util/vflag"
+)
+
+// names the CSRF token is read from
+const (
+	CSRFFieldName  = "csrf_token"
+	CSRFHeaderName = "X-CSRF-Token"
+)
+
+// CSRFOptions configures CSRF
+type CSRFOptions struct {
+	CookieName string // defaults to 'csrf_token'
+}
+
+var flagCSRF bool
+
+func csrfPreInit() {
+	vflag.BoolVar(&flagCSRF, "csrf", false, "Enable this flag to require a CSRF token on every request that is not a GET, HEAD, OPTIONS, or TRACE.")
+}
+
+// CSRF protects unsafe requests with a double-submit cookie. A random token is
+// kept in a cookie and must be sent back in the CSRFFieldName form value or the
+// CSRFHeaderName header of every request that is not a GET, HEAD, OPTIONS, or
+// TRACE. Routes that get one without a valid token answer with a 403 before their
+// handler runs, unless they were registered with CSRFExempt. The Controller form
+// getters and BindJSON check the token again in case the route is reached some other way.
+func CSRF(opts CSRFOptions) Middleware {
+	if len(opts.CookieName) == 0 {
+		opts.CookieName = "csrf_token"
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := ""
+			if c, err := r.Cookie(opts.CookieName); err == nil && len(c.Value) == 43 {
+				token = c.Value
+			} else {
+				token = newCSRFToken()
+				http.SetCookie(w, &http.Cookie{
+					Name:     opts.CookieName,
+					Value:    token,
+					Path:     serverOf(r).Base(),
+					Secure:   r.TLS != nil,
+					HttpOnly: true,
+					SameSite: http.SameSiteLaxMode,
+				})
+			}
+			next.ServeHTTP(w, withValue(r, ctxKeyCSRF, token))
+		})
+	}
+}
+
+// CSRFToken returns the token that forms in the response to r must send back,
+// or "" if CSRF is not enabled
+func CSRFToken(r *http.Request) string {
+	s, _ := r.Context().Value(ctxKeyCSRF).(string)
+	return s
+}
+
+func newCSRFToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// CSRFExempt turns off the CSRF check of a route, such as for a webhook that is
+// authenticated some other way
+func CSRFExempt() RouteOption {
+	return func(ri *routeInfo) {
+		ri.csrfExempt = true
+	}
+}
+
+// csrfCheck wraps h so that unsafe requests without a valid token are rejected
+// before it runs. It does nothing if CSRF is not enabled for the request.
+func csrfCheck(h http.Handler, ri *routeInfo) http.Handler {
+	if ri.csrfExempt {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		GetController(r).AssertCSRF()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// AssertCSRF will exit this http method with a 403 if CSRF is enabled and r is an
+// unsafe request without a valid token. Routes registered with CSRFExempt always pass.
+func (v *Controller) AssertCSRF() {
+	if v.csrfChecked || (v.route != nil && v.route.csrfExempt) {
+		return
+	}
+	v.csrfChecked = true
+	token := CSRFToken(v.r)
+	if len(token) == 0 {
+		return
+	}
+	switch v.r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return
+	}
+	sent := v.r.Header.Get(CSRFHeaderName)
+	if len(sent) == 0 {
+		v.parseForm()
+		sent = v.r.PostFormValue(CSRFFieldName)
+	}
+	v.AssertStatus(len(sent) > 0, http.StatusForbidden, "missing csrf token")
+	v.AssertStatus(subtle.ConstantTimeCompare([]byte(sent), []byte(token)) == 1, http.StatusForbidden, "invalid csrf token")
+}
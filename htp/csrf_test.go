@@ -0,0 +1,103 @@
+package htp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCSRF(t *testing.T) {
+	s, err := New(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Use(CSRF(CSRFOptions{}))
+	s.RegisterE("/form", http.MethodPost, func(c *Controller, w http.ResponseWriter, r *http.Request) error {
+		io.WriteString(w, c.GetFormString("name"))
+		return nil
+	})
+	s.RegisterE("/json", http.MethodPost, func(c *Controller, w http.ResponseWriter, r *http.Request) error {
+		v := struct {
+			Name string `json:"name"`
+		}{}
+		c.BindJSON(&v)
+		io.WriteString(w, v.Name)
+		return nil
+	})
+	s.RegisterE("/raw", http.MethodPost, func(c *Controller, w http.ResponseWriter, r *http.Request) error {
+		c.AssertCSRF()
+		return nil
+	})
+	s.Register("/direct", http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.FormValue("name"))
+	})
+	s.Register("/delete", http.MethodDelete, func(w http.ResponseWriter, r *http.Request) {})
+	s.RegisterE("/hook", http.MethodPost, func(c *Controller, w http.ResponseWriter, r *http.Request) error {
+		c.AssertCSRF()
+		io.WriteString(w, c.GetFormString("name"))
+		return nil
+	}, CSRFExempt())
+	h := s.Handler()
+
+	// a first visit gets a token cookie
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "csrf_token" || len(cookies[0].Value) != 43 || !cookies[0].HttpOnly {
+		t.Fatalf("cookies = %v, want an HttpOnly csrf_token", cookies)
+	}
+	token := cookies[0].Value
+
+	form := func(tok string) string {
+		return url.Values{"name": {"bob"}, CSRFFieldName: {tok}}.Encode()
+	}
+	cases := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		header      string
+		cookie      bool
+		status      int
+	}{
+		{"form with token", http.MethodPost, "/form", "application/x-www-form-urlencoded", form(token), "", true, http.StatusOK},
+		{"form with header", http.MethodPost, "/form", "application/x-www-form-urlencoded", "name=bob", token, true, http.StatusOK},
+		{"form without token", http.MethodPost, "/form", "application/x-www-form-urlencoded", "name=bob", "", true, http.StatusForbidden},
+		{"form with wrong token", http.MethodPost, "/form", "application/x-www-form-urlencoded", form(token[1:] + "x"), "", true, http.StatusForbidden},
+		{"form without cookie", http.MethodPost, "/form", "application/x-www-form-urlencoded", form(token), "", false, http.StatusForbidden},
+		{"json with header", http.MethodPost, "/json", "application/json", `{"name":"bob"}`, token, true, http.StatusOK},
+		{"json without header", http.MethodPost, "/json", "application/json", `{"name":"bob"}`, "", true, http.StatusForbidden},
+		{"json without content type", http.MethodPost, "/json", "", `{"name":"bob"}`, token, true, http.StatusUnsupportedMediaType},
+		{"json as text", http.MethodPost, "/json", "text/plain", `{"name":"bob"}`, token, true, http.StatusUnsupportedMediaType},
+		{"no body with header", http.MethodPost, "/raw", "", "", token, true, http.StatusOK},
+		{"no body without header", http.MethodPost, "/raw", "", "", "", true, http.StatusForbidden},
+		{"handler reading the form itself with token", http.MethodPost, "/direct", "application/x-www-form-urlencoded", form(token), "", true, http.StatusOK},
+		{"handler reading the form itself without token", http.MethodPost, "/direct", "application/x-www-form-urlencoded", "name=bob", "", true, http.StatusForbidden},
+		{"handler reading nothing with header", http.MethodDelete, "/delete", "", "", token, true, http.StatusOK},
+		{"handler reading nothing without header", http.MethodDelete, "/delete", "", "", "", true, http.StatusForbidden},
+		{"exempt route without token", http.MethodPost, "/hook", "application/x-www-form-urlencoded", "name=bob", "", false, http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			if len(tc.contentType) > 0 {
+				r.Header.Set("Content-Type", tc.contentType)
+			}
+			if len(tc.header) > 0 {
+				r.Header.Set(CSRFHeaderName, tc.header)
+			}
+			if tc.cookie {
+				r.AddCookie(&http.Cookie{Name: "csrf_token", Value: token})
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+			if rec.Code != tc.status {
+				t.Errorf("status = %d, want %d", rec.Code, tc.status)
+			}
+		})
+	}
+}
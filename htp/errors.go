@@ -0,0 +1,79 @@
+package htp
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// HTTPError is the error type used to exit a handler with a specific http status
+type HTTPError struct {
+	Status  int                    // http status code sent to the client
+	Message string                 // public message safe to show to the client
+	Err     error                  // internal cause, never shown to the client
+	Details map[string]interface{} // optional extra data for the client
+}
+
+// NewError returns a new HTTPError with status and message
+func NewError(status int, message string) *HTTPError {
+	return &HTTPError{Status: status, Message: message}
+}
+
+// WrapError returns a new HTTPError with status and message caused by err
+func WrapError(status int, message string, err error) *HTTPError {
+	return &HTTPError{Status: status, Message: message, Err: err}
+}
+
+// Error implements the error interface
+func (e *HTTPError) Error() string {
+	s := "htp: " + strconv.Itoa(e.Status) + ": " + e.Message
+	if e.Err != nil {
+		s += ": " + e.Err.Error()
+	}
+	return s
+}
+
+// Unwrap allows errors.Is and errors.As to see the internal cause
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// WithDetail adds key to this error's Details and returns it
+func (e *HTTPError) WithDetail(key string, value interface{}) *HTTPError {
+	if e.Details == nil {
+		e.Details = map[string]interface{}{}
+	}
+	e.Details[key] = value
+	return e
+}
+
+// IsRedirect returns true if this error tells the client to go to another location
+func (e *HTTPError) IsRedirect() bool {
+	return e.Status >= 300 && e.Status < 400 && e.Status != http.StatusNotModified
+}
+
+// AsHTTPError finds the first HTTPError in err's chain. Any other non-nil error is
+// wrapped in a 500 so that its text does not leak to the client.
+func AsHTTPError(err error) *HTTPError {
+	if err == nil {
+		return nil
+	}
+	var he *HTTPError
+	if errors.As(err, &he) {
+		return he
+	}
+	return WrapError(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), err)
+}
+
+// parseMessage splits the legacy "403: message" format into its parts. Messages
+// without a valid "NNN:" status prefix are treated as a 400.
+func parseMessage(message string) (int, string) {
+	if len(message) >= 4 && message[3] == ':' {
+		code, err := strconv.Atoi(message[:3])
+		if err == nil && code >= 100 && code < 600 {
+			return code, strings.TrimPrefix(message[4:], " ")
+		}
+	}
+	return http.StatusBadRequest, message
+}
@@ -0,0 +1,29 @@
+package htp
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParseMessage(t *testing.T) {
+	cases := []struct {
+		in     string
+		status int
+		msg    string
+	}{
+		{"403: not allowed", http.StatusForbidden, "not allowed"},
+		{"404:gone", http.StatusNotFound, "gone"},
+		{"bad input", http.StatusBadRequest, "bad input"},
+		{"2021 is not a valid year", http.StatusBadRequest, "2021 is not a valid year"},
+		{"200 ok", http.StatusBadRequest, "200 ok"},
+		{"999: unknown", http.StatusBadRequest, "999: unknown"},
+		{"403", http.StatusBadRequest, "403"},
+		{"", http.StatusBadRequest, ""},
+	}
+	for _, tc := range cases {
+		status, msg := parseMessage(tc.in)
+		if status != tc.status || msg != tc.msg {
+			t.Errorf("parseMessage(%q) = %d %q, want %d %q", tc.in, status, msg, tc.status, tc.msg)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package htp
+
+import (
+	"net/http"
+	"strings"
+)
+
+// RouteGroup is a set of routes that share a path prefix and middleware
+type RouteGroup struct {
+	s      *Server
+	prefix string
+	mws    []Middleware
+}
+
+// Group returns a RouteGroup on the default server. See Server.Group.
+func Group(prefix string, mws ...Middleware) *RouteGroup {
+	return defaultServer.Group(prefix, mws...)
+}
+
+// Group returns a RouteGroup mounted at prefix under Base(). Middleware is run
+// in order after the route is matched and its Controller is created, so it may
+// use GetController and exit the request with Controller.Assert.
+func (s *Server) Group(prefix string, mws ...Middleware) *RouteGroup {
+	return &RouteGroup{s, cleanPrefix(prefix), mws}
+}
+
+// Group returns a nested RouteGroup that inherits this group's prefix and middleware
+func (g *RouteGroup) Group(prefix string, mws ...Middleware) *RouteGroup {
+	arr := append([]Middleware{}, g.mws...)
+	return &RouteGroup{g.s, g.prefix + cleanPrefix(prefix), append(arr, mws...)}
+}
+
+// Use adds middleware to routes registered on this group after this call
+func (g *RouteGroup) Use(mws ...Middleware) {
+	g.mws = append(g.mws, mws...)
+}
+
+// Prefix returns the path this group is mounted on, relative to Base()
+func (g *RouteGroup) Prefix() string {
+	return g.prefix
+}
+
+// Register adds a handler to this group.
+func (g *RouteGroup) Register(path, method string, h func(w http.ResponseWriter, r *http.Request), opts ...RouteOption) {
+	g.s.register(g.prefix+path, method, http.HandlerFunc(h), g.mws, opts)
+}
+
+// RegisterE adds a handler to this group that reports failure by returning an error
+func (g *RouteGroup) RegisterE(path, method string, h HandlerFunc, opts ...RouteOption) {
+	g.s.register(g.prefix+path, method, h, g.mws, opts)
+}
+
+func cleanPrefix(prefix string) string {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if len(prefix) > 0 && !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	return prefix
+}
@@ -0,0 +1,76 @@
+package htp
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// HandlerFunc is a handler that exits by returning an error instead of panicking.
+// Returned errors are sent through the same pipeline as failed assertions.
+type HandlerFunc func(c *Controller, w http.ResponseWriter, r *http.Request) error
+
+// ServeHTTP implements the http.Handler interface
+func (h HandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h(GetController(r), w, r); err != nil {
+		HandleError(w, r, AsHTTPError(err))
+	}
+}
+
+// HandleError sends err to the client through the Server handling r
+func HandleError(w http.ResponseWriter, r *http.Request, err *HTTPError) {
+	serverOf(r).HandleError(w, r, err)
+}
+
+// HandleError sends err to the client, either as a redirect, a bare 304, or through
+// ErrorHandleFunc. The response will have err.Status unless ErrorHandleFunc sends a different one.
+func (s *Server) HandleError(w http.ResponseWriter, r *http.Request, err *HTTPError) {
+	if err.Status == http.StatusNotModified {
+		w.WriteHeader(err.Status)
+		return
+	}
+	if err.IsRedirect() {
+		w.Header().Add("Location", err.Message)
+		w.WriteHeader(err.Status)
+		return
+	}
+	if err.Err != nil {
+		trace.SpanFromContext(r.Context()).RecordError(err.Err)
+	}
+	f := ErrorHandleFunc
+	if s != nil && s.ErrorHandleFunc != nil {
+		f = s.ErrorHandleFunc
+	}
+	ew := &errorWriter{ResponseWriter: w, status: err.Status}
+	if f != nil {
+		f(ew, r, err)
+	}
+	ew.writeHeader()
+}
+
+// errorWriter sends status before the body if the error handler did not pick one
+type errorWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *errorWriter) writeHeader() {
+	if !w.wroteHeader {
+		w.WriteHeader(w.status)
+	}
+}
+
+func (w *errorWriter) WriteHeader(status int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *errorWriter) Write(b []byte) (int, error) {
+	w.writeHeader()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *errorWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,87 @@
+package htp
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// SecurityHeaders are the security related headers sent with every response.
+// Empty fields are not sent.
+type SecurityHeaders struct {
+	FrameOptions       string `json:"frame_options"`        // X-Frame-Options
+	ContentTypeOptions string `json:"content_type_options"` // X-Content-Type-Options
+	ReferrerPolicy     string `json:"referrer_policy"`      // Referrer-Policy
+	HSTS               string `json:"hsts"`                 // Strict-Transport-Security, only sent over https
+	CSP                string `json:"csp"`                  // Content-Security-Policy, '{nonce}' is replaced by the value of CSPNonce
+	CSPReportOnly      bool   `json:"csp_report_only"`      // send CSP as Content-Security-Policy-Report-Only instead
+	PermissionsPolicy  string `json:"permissions_policy"`   // Permissions-Policy
+}
+
+// Headers is used by DefaultOptions. etc sets it from the 'security_headers'
+// object of the config file.
+var Headers = DefaultSecurityHeaders()
+
+// DefaultSecurityHeaders returns the headers used when none are configured
+func DefaultSecurityHeaders() SecurityHeaders {
+	return SecurityHeaders{
+		FrameOptions:       "sameorigin",
+		ContentTypeOptions: "nosniff",
+		ReferrerPolicy:     "origin",
+	}
+}
+
+// WithSecurityHeaders replaces the headers set by the server for the routes it
+// is used on, such as to allow a page to be framed or to relax its CSP
+func WithSecurityHeaders(h SecurityHeaders) Middleware {
+	return h.middleware
+}
+
+func (h SecurityHeaders) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(h.CSP, "{nonce}") && len(CSPNonce(r)) == 0 {
+			r = withValue(r, ctxKeyNonce, newNonce())
+		}
+		hd := w.Header()
+		set := func(key, value string) {
+			if len(value) == 0 {
+				hd.Del(key)
+				return
+			}
+			hd.Set(key, value)
+		}
+		set("X-Frame-Options", h.FrameOptions)
+		set("X-Content-Type-Options", h.ContentTypeOptions)
+		set("Referrer-Policy", h.ReferrerPolicy)
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			set("Strict-Transport-Security", h.HSTS)
+		}
+		csp := strings.ReplaceAll(h.CSP, "{nonce}", CSPNonce(r))
+		hd.Del("Content-Security-Policy")
+		hd.Del("Content-Security-Policy-Report-Only")
+		if h.CSPReportOnly {
+			set("Content-Security-Policy-Report-Only", csp)
+		} else {
+			set("Content-Security-Policy", csp)
+		}
+		set("Permissions-Policy", h.PermissionsPolicy)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CSPNonce returns the nonce of the Content-Security-Policy sent in response to r.
+// Inline scripts and styles with a matching nonce attribute are allowed to run.
+// It is "" when the CSP has no '{nonce}' in it.
+func CSPNonce(r *http.Request) string {
+	s, _ := r.Context().Value(ctxKeyNonce).(string)
+	return s
+}
+
+func newNonce() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
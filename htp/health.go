@@ -0,0 +1,140 @@
+package htp
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/nektro/go-util/vflag"
+)
+
+// Version is reported by /version. etc sets it to etc.Version.
+var Version = ""
+
+// ReadyTimeout is how long /readyz waits for its checks
+var ReadyTimeout = 5 * time.Second
+
+var flagHealth bool
+
+func healthPreInit() {
+	vflag.BoolVar(&flagHealth, "health", false, "Enable this flag to serve /healthz, /readyz, and /version.")
+}
+
+type readyCheck struct {
+	name string
+	f    func() error
+}
+
+type checkResult struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// AddReadyCheck adds a check run by /readyz on the default server
+func AddReadyCheck(name string, f func() error) {
+	defaultServer.AddReadyCheck(name, f)
+}
+
+// AddReadyCheck adds a check run by /readyz. The server is not ready while f
+// returns an error, such as while a database is unreachable.
+func (s *Server) AddReadyCheck(name string, f func() error) {
+	s.checksMtx.Lock()
+	defer s.checksMtx.Unlock()
+	s.checks = append(s.checks, readyCheck{name, f})
+}
+
+// registerHealth adds /healthz, /readyz, and /version
+func (s *Server) registerHealth() {
+	s.register("/healthz", http.MethodGet, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	}), nil, []RouteOption{Hidden()})
+	s.register("/readyz", http.MethodGet, http.HandlerFunc(s.serveReady), nil, []RouteOption{Hidden()})
+	s.register("/version", http.MethodGet, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, versionInfo())
+	}), nil, []RouteOption{Hidden()})
+}
+
+func (s *Server) serveReady(w http.ResponseWriter, r *http.Request) {
+	s.checksMtx.Lock()
+	checks := append([]readyCheck{}, s.checks...)
+	s.checksMtx.Unlock()
+
+	// checks run at the same time, those still running at the timeout fail
+	res := map[string]checkResult{}
+	mtx := new(sync.Mutex)
+	wg := new(sync.WaitGroup)
+	for _, item := range checks {
+		res[item.name] = checkResult{"fail", float64(ReadyTimeout) / float64(time.Millisecond), "timed out"}
+	}
+	for _, item := range checks {
+		wg.Add(1)
+		go func(c readyCheck) {
+			defer wg.Done()
+			start := time.Now()
+			err := c.f()
+			cr := checkResult{"ok", float64(time.Since(start)) / float64(time.Millisecond), ""}
+			if err != nil {
+				cr.Status, cr.Error = "fail", err.Error()
+			}
+			mtx.Lock()
+			res[c.name] = cr
+			mtx.Unlock()
+		}(item)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(ReadyTimeout):
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	status, code := "ok", http.StatusOK
+	for _, item := range res {
+		if item.Status != "ok" {
+			status, code = "fail", http.StatusServiceUnavailable
+		}
+	}
+	writeJSON(w, code, map[string]interface{}{"status": status, "checks": res})
+}
+
+func versionInfo() map[string]interface{} {
+	res := map[string]interface{}{
+		"version": Version,
+		"go":      runtime.Version(),
+		"os":      runtime.GOOS,
+		"arch":    runtime.GOARCH,
+	}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return res
+	}
+	res["module"] = bi.Main.Path
+	res["module_version"] = bi.Main.Version
+	for _, item := range bi.Settings {
+		switch item.Key {
+		case "vcs.revision":
+			res["revision"] = item.Value
+		case "vcs.time":
+			res["revision_time"] = item.Value
+		case "vcs.modified":
+			res["modified"] = item.Value == "true"
+		}
+	}
+	return res
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
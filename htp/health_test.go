@@ -0,0 +1,70 @@
+package htp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReadyz(t *testing.T) {
+	defer func(d time.Duration) { ReadyTimeout = d }(ReadyTimeout)
+	ReadyTimeout = 50 * time.Millisecond
+
+	ok := func() error { return nil }
+	fail := func() error { return errors.New("db down") }
+	slow := func() error { time.Sleep(time.Second); return nil }
+	type check struct {
+		name string
+		f    func() error
+	}
+	cases := []struct {
+		name   string
+		checks []check
+		status int
+		want   map[string]string // status of each check
+		errors map[string]string
+	}{
+		{"no checks", nil, http.StatusOK, map[string]string{}, nil},
+		{"all ok", []check{{"db", ok}, {"cache", ok}}, http.StatusOK, map[string]string{"db": "ok", "cache": "ok"}, nil},
+		{"one failing", []check{{"db", fail}, {"cache", ok}}, http.StatusServiceUnavailable, map[string]string{"db": "fail", "cache": "ok"}, map[string]string{"db": "db down"}},
+		{"one too slow", []check{{"db", slow}, {"cache", ok}}, http.StatusServiceUnavailable, map[string]string{"db": "fail", "cache": "ok"}, map[string]string{"db": "timed out"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := New(Options{Health: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, item := range tc.checks {
+				s.AddReadyCheck(item.name, item.f)
+			}
+			rec := httptest.NewRecorder()
+			start := time.Now()
+			s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if d := time.Since(start); d > 500*time.Millisecond {
+				t.Errorf("took %s, want it to stop waiting at ReadyTimeout", d)
+			}
+			if rec.Code != tc.status {
+				t.Errorf("status = %d, want %d", rec.Code, tc.status)
+			}
+			res := struct {
+				Status string                 `json:"status"`
+				Checks map[string]checkResult `json:"checks"`
+			}{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if len(res.Checks) != len(tc.want) {
+				t.Errorf("checks = %v, want %v", res.Checks, tc.want)
+			}
+			for name, status := range tc.want {
+				if res.Checks[name].Status != status || res.Checks[name].Error != tc.errors[name] {
+					t.Errorf("check %s = %+v, want %s %q", name, res.Checks[name], status, tc.errors[name])
+				}
+			}
+		})
+	}
+}
@@ -2,28 +2,35 @@ package htp
 
 import (
 	"context"
-	"fmt"
 	"mime"
+	"net"
 	"net/http"
+	"os"
 	"strconv"
-	"strings"
-	"sync"
+	"time"
 
-	"github.com/gorilla/mux"
 	"github.com/nektro/go-util/util"
 	"github.com/nektro/go-util/vflag"
+	"github.com/nektro/go.etc/htp/middleware"
 )
 
 // globals
 var (
-	router          *mux.Router
-	ErrorHandleFunc func(http.ResponseWriter, *http.Request, string)
-	controllers     map[*http.Request]*Controller
+	ErrorHandleFunc func(http.ResponseWriter, *http.Request, *HTTPError)
 	base            = vflag.String("base", "/", "The path to mount all listeners on")
-	baseReal        string
-	srv             *http.Server
-	mtx             = new(sync.Mutex)
-	allowedips      = []string{}
+	defaultServer   *Server
+)
+
+type ctxKey int
+
+// context keys
+const (
+	ctxKeyController ctxKey = iota
+	ctxKeyServer
+	ctxKeyCSRF
+	ctxKeyNonce
+	ctxKeyBodyLimit
+	ctxKeyJWT
 )
 
 func init() {
@@ -111,128 +118,139 @@ func init() {
 
 // PreInit sets up flags
 func PreInit() {
-	vflag.StringArrayVar(&allowedips, "allow-ip", []string{}, "Only allow requests from specific IP pattern. Use 'x' for replacements.")
+	listenPreInit()
+	tlsPreInit()
+	shutdownPreInit()
+	staticPreInit()
+	csrfPreInit()
+	limitsPreInit()
+	healthPreInit()
+	metricsPreInit()
+	tracingPreInit()
+	openapiPreInit()
+	middleware.PreInit()
 }
 
 // Init sets up globals to their default state
 func Init() {
-	router = mux.NewRouter()
-	ErrorHandleFunc = func(http.ResponseWriter, *http.Request, string) {}
-	controllers = map[*http.Request]*Controller{}
-	util.DieOnError(util.Assert(strings.HasSuffix(*base, "/"), "--base must end in '/'"))
-	baseReal = strings.TrimSuffix(*base, "/")
-
-	router.Use(func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Add("X-Frame-Options", "sameorigin")
-			w.Header().Add("X-Content-Type-Options", "nosniff")
-			w.Header().Add("Referrer-Policy", "origin")
-			next.ServeHTTP(w, r)
-		})
-	})
-	router.Use(func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			a := strings.Split(strings.Split(r.RemoteAddr, ":")[0], ".")
-			for _, item := range allowedips {
-				for j, jtem := range strings.Split(item, ".") {
-					if jtem == "x" {
-						continue
-					}
-					if jtem != a[j] {
-						fmt.Fprintln(w, "403 forbidden")
-						fmt.Fprintln(w, "ip not allowed")
-						return
-					}
-				}
-			}
-			next.ServeHTTP(w, r)
-		})
-	})
-}
-
-// Register adds a handler to this router.
-func Register(path, method string, h func(w http.ResponseWriter, r *http.Request)) {
-	methods := []string{}
-	if len(method) > 0 {
-		methods = append(methods, method)
+	ErrorHandleFunc = func(http.ResponseWriter, *http.Request, *HTTPError) {}
+	s, err := New(DefaultOptions())
+	util.DieOnError(err)
+	defaultServer = s
+	if len(Tracing.Exporter) > 0 {
+		shutdown, err := SetupTracing(Tracing)
+		util.DieOnError(err)
+		OnShutdown(shutdown)
 	}
-	if method == http.MethodGet {
-		methods = append(methods, http.MethodHead)
+	Use(middleware.Defaults()...)
+	if flagCSRF {
+		Use(CSRF(CSRFOptions{}))
 	}
-	rt := router.NewRoute()
-	rt.Methods(methods...)
-	if strings.HasSuffix(path, "/*") {
-		rt.PathPrefix(baseReal + strings.TrimSuffix(path, "*"))
-	} else {
-		rt.Path(baseReal + path)
+}
+
+// DefaultOptions returns the Options set by flags
+func DefaultOptions() Options {
+	mode, err := strconv.ParseUint(flagSocketMode, 8, 32)
+	util.DieOnError(err, "invalid --socket-mode:", flagSocketMode)
+	timeout, err := time.ParseDuration(flagShutdownTimeout)
+	util.DieOnError(err, "invalid --shutdown-timeout:", flagShutdownTimeout)
+	return Options{
+		Base:            *base,
+		ShutdownTimeout: timeout,
+		SocketMode:      os.FileMode(mode),
+		TLS:             TLS,
+		SecurityHeaders: &Headers,
+		Health:          flagHealth,
+		Metrics:         flagMetrics,
+		MetricsBind:     flagMetricsBind,
+		OpenAPI:         flagOpenAPI,
+		OpenAPIUI:       flagOpenAPIUI,
+		Static:          staticOptions(),
+
+		ReadTimeout:       durationFlag("read-timeout", Limits.ReadTimeout),
+		ReadHeaderTimeout: durationFlag("read-header-timeout", Limits.ReadHeaderTimeout),
+		WriteTimeout:      durationFlag("write-timeout", Limits.WriteTimeout),
+		IdleTimeout:       durationFlag("idle-timeout", Limits.IdleTimeout),
+		MaxHeaderBytes:    Limits.MaxHeaderBytes,
+		MaxBodyBytes:      int64(Limits.MaxBodyBytes),
 	}
-	rt.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		defer func() {
-			if rcv := recover(); rcv != nil {
-				rcvs := fmt.Sprintf("%v", rcv)
-				if t1 := strings.TrimPrefix(rcvs, "htp: "); t1 != rcvs {
-					if t2 := strings.TrimPrefix(t1, "assertion failed: "); t2 != t1 {
-						ErrorHandleFunc(w, r, t2)
-						return
-					}
-					if t2 := strings.TrimPrefix(t1, "redirect: "); t2 != t1 {
-						w.Header().Add("Location", t2)
-						w.WriteHeader(http.StatusFound)
-						return
-					}
-				}
-				panic(rcvs)
-			}
-		}()
-		h(w, r)
-		mtx.Lock()
-		delete(controllers, r)
-		mtx.Unlock()
-	})
+}
+
+// Default returns the Server used by the package level functions
+func Default() *Server {
+	return defaultServer
+}
+
+// Handler returns the http.Handler of the default Server
+func Handler() http.Handler {
+	return defaultServer.Handler()
+}
+
+// Register adds a handler to this router.
+func Register(path, method string, h func(w http.ResponseWriter, r *http.Request), opts ...RouteOption) {
+	defaultServer.Register(path, method, h, opts...)
+}
+
+// RegisterE adds a handler that reports failure by returning an error
+func RegisterE(path, method string, h HandlerFunc, opts ...RouteOption) {
+	defaultServer.RegisterE(path, method, h, opts...)
 }
 
 // GetController allows you to gain access to this method's htp.Controller
 func GetController(r *http.Request) *Controller {
-	mtx.Lock()
-	defer mtx.Unlock()
-
-	c, ok := controllers[r]
+	c, ok := r.Context().Value(ctxKeyController).(*Controller)
 	if !ok {
-		c = &Controller{r}
-		controllers[r] = c
+		return &Controller{r: r}
 	}
 	return c
 }
 
+// withController returns a shallow copy of r whose context holds a new Controller for route
+func withController(r *http.Request, route *routeInfo) *http.Request {
+	c := &Controller{route: route}
+	c.r = r.WithContext(context.WithValue(r.Context(), ctxKeyController, c))
+	return c.r
+}
+
+// withValue returns a shallow copy of r with key set in its context. The
+// Controller of r, if it has one, is updated to see the new value as well.
+func withValue(r *http.Request, key ctxKey, value interface{}) *http.Request {
+	return withContext(r, context.WithValue(r.Context(), key, value))
+}
+
+// withContext returns a shallow copy of r with ctx, updating its Controller as withValue does
+func withContext(r *http.Request, ctx context.Context) *http.Request {
+	r = r.WithContext(ctx)
+	if c, ok := r.Context().Value(ctxKeyController).(*Controller); ok {
+		c.r = r
+	}
+	return r
+}
+
 // RegisterFileSystem is a custom version of Register where it adds a http.FileSystem to the router
 func RegisterFileSystem(fs http.FileSystem) {
-	p := baseReal + "/"
-	router.PathPrefix(p).Handler(http.StripPrefix(p, http.FileServer(fs)))
+	defaultServer.RegisterFileSystem(fs)
 }
 
 // Base returns the root that all methods are mounted on
 func Base() string {
-	return baseReal + "/"
+	return defaultServer.Base()
 }
 
-// StartServer initializes this server and listens on port
-func StartServer(bind string, port int) {
-	p := strconv.Itoa(port)
-	util.DieOnError(util.Assert(util.IsPortAvailable(port), "Binding to port "+p+" failed."), "It may be taken or you may not have permission to. Aborting!")
-	util.Log("Starting server on port " + p)
-	if util.AreWeInContainer() {
-		util.LogWarn("Looks like we might be running inside a container, so " + p + " might not be the actual port to access this server.")
-	}
-	util.Log("Initialization complete.")
-	srv = &http.Server{
-		Handler: router,
-		Addr:    bind + ":" + p,
-	}
-	srv.ListenAndServe()
+// StartServer initializes this server and listens on the socket returned by
+// Listen until it is stopped. See Serve.
+func StartServer(bind string, port int) error {
+	return defaultServer.StartServer(bind, port)
+}
+
+// Serve handles requests on l until it is stopped by StopServer, SIGINT, or
+// SIGTERM. In-flight requests are given --shutdown-timeout to finish and then
+// the OnShutdown hooks are run.
+func Serve(l net.Listener) error {
+	return defaultServer.Serve(l)
 }
 
 // StopServer performs a graceful shutdown of the HTTP server
-func StopServer() {
-	srv.Close()
-	srv.Shutdown(context.Background())
+func StopServer() error {
+	return defaultServer.Stop()
 }
@@ -0,0 +1,125 @@
+package htp
+
+import (
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/nektro/go.etc/store"
+)
+
+// Hub sends messages to every subscriber of a topic, such as the clients of a
+// WebSocket or SSE endpoint. When store.This supports store.PubSub, as with the
+// redis store, messages are passed through it so that subscribers on every app
+// instance receive them.
+type Hub struct {
+	name      string
+	mtx       sync.Mutex
+	subs      map[string]map[*Subscription]bool
+	connMtx   sync.Mutex
+	connected bool
+	ps        store.PubSub
+	closer    io.Closer
+}
+
+// Subscription receives the messages sent to a topic of a Hub
+type Subscription struct {
+	C     <-chan []byte
+	c     chan []byte
+	hub   *Hub
+	topic string
+}
+
+// NewHub returns a Hub. name separates its messages from other hubs that share a store.
+func NewHub(name string) *Hub {
+	return &Hub{name: name, subs: map[string]map[*Subscription]bool{}}
+}
+
+// connect subscribes to the store the first time it is called after store.Init,
+// as hubs are often made before the store is set up. It returns the store if it
+// supports store.PubSub, or nil if messages stay local.
+func (h *Hub) connect() store.PubSub {
+	h.connMtx.Lock()
+	defer h.connMtx.Unlock()
+	if h.connected || store.This == nil {
+		return h.ps
+	}
+	h.connected = true
+	ps, ok := store.This.Inner.(store.PubSub)
+	if !ok {
+		return nil
+	}
+	ch, closer := ps.Subscribe("htp:hub:" + h.name)
+	h.ps, h.closer = ps, closer
+	go func() {
+		for item := range ch {
+			// messages are 'topic\nmessage'
+			kv := strings.SplitN(item, "\n", 2)
+			if len(kv) == 2 {
+				h.deliver(kv[0], []byte(kv[1]))
+			}
+		}
+	}()
+	return ps
+}
+
+// Subscribe returns a Subscription to topic. It must be closed when no longer used.
+func (h *Hub) Subscribe(topic string) *Subscription {
+	h.connect()
+	c := make(chan []byte, 16)
+	sub := &Subscription{c, c, h, topic}
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if h.subs[topic] == nil {
+		h.subs[topic] = map[*Subscription]bool{}
+	}
+	h.subs[topic][sub] = true
+	return sub
+}
+
+// Publish sends msg to every subscriber of topic. topic must not contain a newline.
+func (h *Hub) Publish(topic string, msg []byte) error {
+	if ps := h.connect(); ps != nil {
+		return ps.Publish("htp:hub:"+h.name, topic+"\n"+string(msg))
+	}
+	h.deliver(topic, msg)
+	return nil
+}
+
+// deliver sends msg to the local subscribers of topic. Subscribers that are too
+// far behind miss the message rather than hold up the others.
+func (h *Hub) deliver(topic string, msg []byte) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	for sub := range h.subs[topic] {
+		select {
+		case sub.c <- msg:
+		default:
+		}
+	}
+}
+
+// Close stops this Hub from receiving messages from other app instances
+func (h *Hub) Close() error {
+	h.connect()
+	h.connMtx.Lock()
+	defer h.connMtx.Unlock()
+	if h.closer == nil {
+		return nil
+	}
+	return h.closer.Close()
+}
+
+// Close removes this Subscription from its Hub and closes C
+func (s *Subscription) Close() {
+	s.hub.mtx.Lock()
+	defer s.hub.mtx.Unlock()
+	if !s.hub.subs[s.topic][s] {
+		return
+	}
+	delete(s.hub.subs[s.topic], s)
+	if len(s.hub.subs[s.topic]) == 0 {
+		delete(s.hub.subs, s.topic)
+	}
+	close(s.c)
+}
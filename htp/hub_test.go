@@ -0,0 +1,63 @@
+package htp
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/nektro/go.etc/store"
+)
+
+// fakePubSub is a store that echoes published messages back to its subscriber
+type fakePubSub struct {
+	store.Inner
+	ch        chan string
+	published int
+}
+
+func (f *fakePubSub) Publish(channel, message string) error {
+	f.published++
+	f.ch <- message
+	return nil
+}
+
+func (f *fakePubSub) Subscribe(channel string) (<-chan string, io.Closer) {
+	return f.ch, f
+}
+
+func (f *fakePubSub) Close() error {
+	close(f.ch)
+	return nil
+}
+
+func TestHubConnectsAfterStoreInit(t *testing.T) {
+	h := NewHub("test")
+	sub := h.Subscribe("a")
+	defer sub.Close()
+
+	// before the store is set up messages are delivered locally
+	if err := h.Publish("a", []byte("local")); err != nil {
+		t.Fatal(err)
+	}
+	if msg := string(<-sub.C); msg != "local" {
+		t.Fatalf("got %q, want local", msg)
+	}
+
+	ps := &fakePubSub{ch: make(chan string, 1)}
+	store.This = &store.Store{Inner: ps}
+	defer func() { store.This = nil }()
+	if err := h.Publish("a", []byte("shared")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-sub.C:
+		if string(msg) != "shared" || ps.published != 1 {
+			t.Fatalf("got %q after %d publishes, want shared through the store", msg, ps.published)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message was not delivered through the store")
+	}
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,112 @@
+package htp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nektro/go-util/util"
+	"github.com/nektro/go-util/vflag"
+)
+
+// LimitsConfig holds the timeouts and size limits of the default server.
+// Durations are strings such as '1m', and empty ones are disabled.
+type LimitsConfig struct {
+	ReadTimeout       string `json:"read_timeout"`
+	ReadHeaderTimeout string `json:"read_header_timeout"`
+	WriteTimeout      string `json:"write_timeout"`
+	IdleTimeout       string `json:"idle_timeout"`
+	MaxHeaderBytes    int    `json:"max_header_bytes"`
+	MaxBodyBytes      int    `json:"max_body_bytes"`
+}
+
+// Limits is the LimitsConfig set by flags and used by DefaultOptions. etc sets it
+// from the 'limits' object of the config file, which flags given on the command line override.
+var Limits LimitsConfig
+
+func limitsPreInit() {
+	vflag.StringVar(&Limits.ReadTimeout, "read-timeout", "", "Maximum duration for reading an entire request, such as '1m'. Leave empty to disable.")
+	vflag.StringVar(&Limits.ReadHeaderTimeout, "read-header-timeout", "10s", "Maximum duration for reading request headers. Leave empty to disable.")
+	vflag.StringVar(&Limits.WriteTimeout, "write-timeout", "", "Maximum duration for writing a response, such as '1m'. Leave empty to disable.")
+	vflag.StringVar(&Limits.IdleTimeout, "idle-timeout", "2m", "How long to keep idle keep-alive connections open. Leave empty to disable.")
+	vflag.IntVar(&Limits.MaxHeaderBytes, "max-header-bytes", http.DefaultMaxHeaderBytes, "Maximum size of request headers in bytes.")
+	vflag.IntVar(&Limits.MaxBodyBytes, "max-body-bytes", 32<<20, "Maximum size of request bodies in bytes. Set to 0 to disable.")
+}
+
+func durationFlag(name, value string) time.Duration {
+	if len(value) == 0 {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	util.DieOnError(err, "invalid --"+name+":", value)
+	return d
+}
+
+// httpServer returns a http.Server for h with the limits in s.opts
+func (s *Server) httpServer(h http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           h,
+		BaseContext:       func(net.Listener) context.Context { return s.baseCtx },
+		ReadTimeout:       s.opts.ReadTimeout,
+		ReadHeaderTimeout: s.opts.ReadHeaderTimeout,
+		WriteTimeout:      s.opts.WriteTimeout,
+		IdleTimeout:       s.opts.IdleTimeout,
+		MaxHeaderBytes:    s.opts.MaxHeaderBytes,
+	}
+}
+
+// MaxBodyBytes replaces Options.MaxBodyBytes for the routes it is used on. Set
+// n to 0 to allow any size.
+func MaxBodyBytes(n int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, withValue(r, ctxKeyBodyLimit, n))
+		})
+	}
+}
+
+// BodyLimit replaces Options.MaxBodyBytes, and any MaxBodyBytes of its group,
+// for a single route. Set n to 0 to allow any size.
+func BodyLimit(n int64) RouteOption {
+	return func(ri *routeInfo) {
+		ri.maxBody = &n
+	}
+}
+
+// limitBody wraps h so that request bodies larger than the limit for its route
+// are rejected with a 413. Bodies without a Content-Length fail when read past
+// the limit, which the Controller getters turn into a 413 as well.
+func (s *Server) limitBody(h http.Handler, ri *routeInfo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, ok := r.Context().Value(ctxKeyBodyLimit).(int64)
+		if !ok {
+			n = s.opts.MaxBodyBytes
+		}
+		if ri.maxBody != nil {
+			n = *ri.maxBody
+		}
+		if n > 0 && r.Body != nil {
+			if r.ContentLength > n {
+				s.HandleError(w, r, NewError(http.StatusRequestEntityTooLarge, "request body must be at most "+strconv.FormatInt(n, 10)+" bytes"))
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+			if c, ok := r.Context().Value(ctxKeyController).(*Controller); ok {
+				c.r.Body = r.Body
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// bodyError returns a 413 if err was caused by reading past the body limit
+func bodyError(err error) *HTTPError {
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		return WrapError(http.StatusRequestEntityTooLarge, "request body must be at most "+strconv.FormatInt(mbe.Limit, 10)+" bytes", err)
+	}
+	return nil
+}
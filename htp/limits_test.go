@@ -0,0 +1,59 @@
+package htp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyLimit(t *testing.T) {
+	s, err := New(Options{MaxBodyBytes: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.Write(b)
+	}
+	s.Register("/default", http.MethodPost, read)
+	s.Register("/route", http.MethodPost, read, BodyLimit(16))
+	g := s.Group("/group", MaxBodyBytes(4))
+	g.Register("/x", http.MethodPost, read)
+	g.Register("/route", http.MethodPost, read, BodyLimit(0))
+	h := s.Handler()
+
+	cases := []struct {
+		path   string
+		size   int
+		status int
+	}{
+		{"/default", 8, http.StatusOK},
+		{"/default", 9, http.StatusRequestEntityTooLarge},
+		{"/route", 16, http.StatusOK},
+		{"/route", 17, http.StatusRequestEntityTooLarge},
+		{"/group/x", 4, http.StatusOK},
+		{"/group/x", 5, http.StatusRequestEntityTooLarge},
+		{"/group/route", 1 << 10, http.StatusOK},
+	}
+	for _, tc := range cases {
+		for _, chunked := range []bool{false, true} {
+			var body io.Reader = strings.NewReader(strings.Repeat("a", tc.size))
+			if chunked {
+				// hide the length so the limit is hit while reading
+				body = io.MultiReader(body)
+			}
+			r := httptest.NewRequest(http.MethodPost, tc.path, body)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+			if rec.Code != tc.status {
+				t.Errorf("%s with %d bytes (chunked %v): status = %d, want %d", tc.path, tc.size, chunked, rec.Code, tc.status)
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package htp
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/nektro/go-util/util"
+	"github.com/nektro/go-util/vflag"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd socket activation
+const listenFdsStart = 3
+
+var (
+	flagSocketMode string
+)
+
+func listenPreInit() {
+	vflag.StringVar(&flagSocketMode, "socket-mode", "0660", "File permissions of the socket when using '--bind unix:/path/to.sock'.")
+}
+
+// Listen returns the listener StartServer serves on for the default server
+func Listen(bind string, port int) (net.Listener, error) {
+	return defaultServer.Listen(bind, port)
+}
+
+// Listen returns the listener StartServer serves on. It is, in order of preference:
+// the socket passed in by systemd socket activation, a unix socket when bind is
+// in the form 'unix:/path/to.sock', or a TCP socket on bind and port.
+func (s *Server) Listen(bind string, port int) (net.Listener, error) {
+	l, err := systemdListener()
+	if err != nil || l != nil {
+		return l, err
+	}
+	if strings.HasPrefix(bind, "unix:") {
+		return listenUnix(strings.TrimPrefix(bind, "unix:"), s.opts.SocketMode)
+	}
+	p := strconv.Itoa(port)
+	if !util.IsPortAvailable(port) {
+		return nil, errors.New("htp: binding to port " + p + " failed, it may be taken or you may not have permission to")
+	}
+	util.Log("Starting server on port " + p)
+	if util.AreWeInContainer() {
+		util.LogWarn("Looks like we might be running inside a container, so " + p + " might not be the actual port to access this server.")
+	}
+	return net.Listen("tcp", net.JoinHostPort(bind, p))
+}
+
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	// remove the socket left behind by a previous run that did not exit cleanly
+	if s, err := os.Stat(path); err == nil && s.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		l.Close()
+		return nil, err
+	}
+	util.Log("Starting server on socket " + path)
+	return l, nil
+}
+
+// systemdListener returns the first socket passed by systemd, or nil if this
+// process was not socket activated
+func systemdListener() (net.Listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, nil
+	}
+	// the variables must not be passed on to child processes
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if n > 1 {
+		util.LogWarn("htp:", "systemd passed", n, "sockets, only the first is used")
+	}
+	f := os.NewFile(listenFdsStart, "LISTEN_FD_"+strconv.Itoa(listenFdsStart))
+	defer f.Close()
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, err
+	}
+	util.Log("Starting server on systemd socket " + l.Addr().String())
+	return l, nil
+}
@@ -0,0 +1,113 @@
+package htp
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nektro/go-util/vflag"
+	"github.com/nektro/go.etc/htp/middleware"
+	"github.com/nektro/go.etc/store"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	flagMetrics     bool
+	flagMetricsBind string
+)
+
+func metricsPreInit() {
+	vflag.BoolVar(&flagMetrics, "metrics", false, "Enable this flag to record Prometheus metrics and serve them at /metrics.")
+	vflag.StringVar(&flagMetricsBind, "metrics-bind", "", "Serve /metrics on this address, such as '127.0.0.1:9100', instead of with the other routes.")
+}
+
+// activeControllers is the number of requests currently holding a Controller
+var activeControllers int64
+
+var (
+	metricsOnce sync.Once
+
+	metricRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "htp_requests_total",
+		Help: "Number of requests handled, by route and status.",
+	}, []string{"method", "route", "status"})
+	metricDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "htp_request_duration_seconds",
+		Help:    "Time taken to handle requests, by route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+	metricInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "htp_requests_in_flight",
+		Help: "Number of requests being handled, by route.",
+	}, []string{"method", "route"})
+	metricSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "htp_response_size_bytes",
+		Help:    "Size of response bodies, by route.",
+		Buckets: prometheus.ExponentialBuckets(100, 10, 7),
+	}, []string{"method", "route"})
+	metricControllers = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "htp_controllers_active",
+		Help: "Number of requests currently holding a Controller.",
+	}, func() float64 {
+		return float64(atomic.LoadInt64(&activeControllers))
+	})
+)
+
+// registerMetrics adds the htp collectors to the default Prometheus registry
+func registerMetrics() {
+	metricsOnce.Do(func() {
+		prometheus.MustRegister(metricRequests, metricDuration, metricInFlight, metricSize, metricControllers, storeCollector{})
+	})
+}
+
+// instrument wraps h to record metrics and the access log route under route,
+// the mux path template
+func (s *Server) instrument(route string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		middleware.SetRoute(r, route)
+		if !s.opts.Metrics {
+			h.ServeHTTP(w, r)
+			return
+		}
+		method := r.Method
+		switch method {
+		case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		default:
+			// keep the number of series bounded
+			method = "OTHER"
+		}
+		inFlight := metricInFlight.WithLabelValues(method, route)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		rec := middleware.Record(w)
+		start := time.Now()
+		h.ServeHTTP(rec, r)
+		status := rec.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		metricRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+		metricDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+		metricSize.WithLabelValues(method, route).Observe(float64(rec.BytesWritten()))
+	})
+}
+
+// storeCollector exports store.OpCounts
+type storeCollector struct{}
+
+var storeOpsDesc = prometheus.NewDesc("store_operations_total", "Number of calls made to store.This, by operation.", []string{"op"}, nil)
+
+// Describe implements the prometheus.Collector interface
+func (storeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- storeOpsDesc
+}
+
+// Collect implements the prometheus.Collector interface
+func (storeCollector) Collect(ch chan<- prometheus.Metric) {
+	for k, v := range store.OpCounts() {
+		ch <- prometheus.MustNewConstMetric(storeOpsDesc, prometheus.CounterValue, float64(v), k)
+	}
+}
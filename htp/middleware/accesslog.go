@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nektro/go-util/util"
+)
+
+// AccessLogOptions configures AccessLogWith
+type AccessLogOptions struct {
+	Format     string    // 'text', 'json', 'logfmt', or 'combined'. Defaults to 'text'.
+	Output     io.Writer // defaults to util.Log for 'text' and stdout for the rest
+	SampleRate float64   // fraction of requests logged, 0 logs all. Server errors are always logged.
+}
+
+// logInfo is filled in by handlers further down the chain for AccessLog to read
+type logInfo struct {
+	route   string
+	subject string
+}
+
+// SetRoute records the route template that matched r, such as '/users/{id}', for AccessLog
+func SetRoute(r *http.Request, route string) {
+	if li, ok := r.Context().Value(ctxKeyLogInfo).(*logInfo); ok {
+		li.route = route
+	}
+}
+
+// SetSubject records the authenticated user making r, such as a JWT 'sub', for AccessLog
+func SetSubject(r *http.Request, subject string) {
+	if li, ok := r.Context().Value(ctxKeyLogInfo).(*logInfo); ok {
+		li.subject = subject
+	}
+}
+
+// AccessLog writes a line for every request to out, or util.Log if out is nil
+func AccessLog(out io.Writer) func(http.Handler) http.Handler {
+	return AccessLogWith(AccessLogOptions{Output: out})
+}
+
+// AccessLogWith writes a line for every request in the format set by opts
+func AccessLogWith(opts AccessLogOptions) func(http.Handler) http.Handler {
+	if len(opts.Format) == 0 {
+		opts.Format = "text"
+	}
+	if opts.Output == nil && opts.Format != "text" {
+		opts.Output = os.Stdout
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := Record(w)
+			li := new(logInfo)
+			r = r.WithContext(context.WithValue(r.Context(), ctxKeyLogInfo, li))
+			defer func() {
+				status := rec.Status()
+				if status == 0 {
+					// net/http sends a 200 for handlers that write nothing
+					status = http.StatusOK
+				}
+				if opts.SampleRate > 0 && opts.SampleRate < 1 && status < 500 && rand.Float64() >= opts.SampleRate {
+					return
+				}
+				e := accessEntry{start, r, status, rec.BytesWritten(), time.Since(start), li}
+				line := ""
+				switch opts.Format {
+				case "json":
+					line = e.json()
+				case "logfmt":
+					line = e.logfmt()
+				case "combined":
+					line = e.combined()
+				default:
+					line = e.text()
+				}
+				if opts.Output == nil {
+					util.Log("htp:", line)
+					return
+				}
+				io.WriteString(opts.Output, line+"\n")
+			}()
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
+
+type accessEntry struct {
+	start    time.Time
+	r        *http.Request
+	status   int
+	bytes    int64
+	duration time.Duration
+	info     *logInfo
+}
+
+func (e accessEntry) text() string {
+	return fmt.Sprintf("%s %s %s %d %d %s %s", ClientIP(e.r), e.r.Method, e.r.URL.RequestURI(), e.status, e.bytes, e.duration, GetRequestID(e.r))
+}
+
+func (e accessEntry) fields() [][2]string {
+	return [][2]string{
+		{"time", e.start.UTC().Format(time.RFC3339Nano)},
+		{"method", e.r.Method},
+		{"route", e.info.route},
+		{"path", e.r.URL.Path},
+		{"status", strconv.Itoa(e.status)},
+		{"bytes", strconv.FormatInt(e.bytes, 10)},
+		{"duration_ms", strconv.FormatFloat(float64(e.duration)/float64(time.Millisecond), 'f', 3, 64)},
+		{"ip", ClientIP(e.r).String()},
+		{"request_id", GetRequestID(e.r)},
+		{"subject", e.info.subject},
+	}
+}
+
+func (e accessEntry) json() string {
+	m := map[string]interface{}{}
+	for _, item := range e.fields() {
+		m[item[0]] = item[1]
+	}
+	m["status"] = e.status
+	m["bytes"] = e.bytes
+	m["duration_ms"] = float64(e.duration) / float64(time.Millisecond)
+	b, _ := json.Marshal(m)
+	return string(b)
+}
+
+func (e accessEntry) logfmt() string {
+	arr := []string{}
+	for _, item := range e.fields() {
+		v := item[1]
+		if len(v) == 0 || strings.ContainsAny(v, " =\"\\\n\t") {
+			v = strconv.Quote(v)
+		}
+		arr = append(arr, item[0]+"="+v)
+	}
+	return strings.Join(arr, " ")
+}
+
+// combined is the Apache/nginx combined log format
+func (e accessEntry) combined() string {
+	user := "-"
+	if len(e.info.subject) > 0 {
+		user = strings.Join(strings.Fields(e.info.subject), "_")
+	}
+	quote := func(s string) string {
+		if len(s) == 0 {
+			return `"-"`
+		}
+		return strconv.Quote(s)
+	}
+	return fmt.Sprintf("%s - %s [%s] %s %d %d %s %s",
+		ClientIP(e.r), user, e.start.Format("02/Jan/2006:15:04:05 -0700"),
+		quote(e.r.Method+" "+e.r.URL.RequestURI()+" "+e.r.Proto),
+		e.status, e.bytes, quote(e.r.Referer()), quote(e.r.UserAgent()))
+}
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// compressible is the set of mime types worth compressing, other than text/*
+var compressible = map[string]bool{
+	"application/javascript":   true,
+	"application/json":         true,
+	"application/ld+json":      true,
+	"application/problem+json": true,
+	"application/xml":          true,
+	"application/xhtml+xml":    true,
+	"image/svg+xml":            true,
+}
+
+// Compress encodes responses with brotli or gzip when the client accepts it and
+// the content type is text based. Responses that already have a Content-Encoding
+// and streaming requests are passed through as is.
+func Compress() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			encs := AcceptedEncodings(r)
+			if len(encs) == 0 || r.Method == http.MethodHead || isStream(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cw := &compressWriter{ResponseWriter: w, encoding: encs[0]}
+			defer cw.Close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// AcceptedEncodings returns the encodings out of brotli and gzip that the client accepts, best first
+func AcceptedEncodings(r *http.Request) []string {
+	br, gz := false, false
+	for _, item := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		parts := strings.Split(strings.TrimSpace(item), ";")
+		if len(parts) > 1 && strings.ReplaceAll(strings.TrimSpace(parts[1]), " ", "") == "q=0" {
+			continue
+		}
+		switch strings.ToLower(parts[0]) {
+		case "br":
+			br = true
+		case "gzip":
+			gz = true
+		}
+	}
+	res := []string{}
+	if br {
+		res = append(res, "br")
+	}
+	if gz {
+		res = append(res, "gzip")
+	}
+	return res
+}
+
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	w           io.WriteCloser
+	wroteHeader bool
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	h := w.Header()
+	ct, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	if status >= http.StatusOK && status != http.StatusNoContent && status != http.StatusNotModified &&
+		h.Get("Content-Encoding") == "" && (strings.HasPrefix(ct, "text/") || compressible[ct]) {
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		if etag := h.Get("ETag"); len(etag) > 0 && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		switch w.encoding {
+		case "br":
+			w.w = brotli.NewWriterLevel(w.ResponseWriter, brotli.DefaultCompression)
+		case "gzip":
+			w.w, _ = gzip.NewWriterLevel(w.ResponseWriter, gzip.DefaultCompression)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.w == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.w.Write(b)
+}
+
+func (w *compressWriter) Close() error {
+	if w.w == nil {
+		return nil
+	}
+	return w.w.Close()
+}
+
+func (w *compressWriter) Flush() {
+	if f, ok := w.w.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("middleware: underlying ResponseWriter does not implement http.Hijacker")
+	}
+	return h.Hijack()
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
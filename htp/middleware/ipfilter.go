@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+)
+
+// IPFilter rejects requests with a 403 if the client IP is in deny, or if allow
+// is not empty and the client IP is not in it. Put RealIP before this to filter
+// on the client behind a trusted reverse proxy.
+func IPFilter(allow, deny []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := ClientIP(r)
+			if !ipAllowed(ip, allow, deny) {
+				Error(w, r, http.StatusForbidden, "ip not allowed")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ipAllowed(ip net.IP, allow, deny []*net.IPNet) bool {
+	if ip == nil {
+		return len(allow) == 0
+	}
+	if containsIP(deny, ip) {
+		return false
+	}
+	return len(allow) == 0 || containsIP(allow, ip)
+}
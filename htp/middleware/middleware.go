@@ -0,0 +1,217 @@
+// Package middleware provides reusable net/http middleware for htp servers.
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nektro/go-util/util"
+	"github.com/nektro/go-util/vflag"
+)
+
+type ctxKey int
+
+// context keys
+const (
+	ctxKeyErrorFunc ctxKey = iota
+	ctxKeyRequestID
+	ctxKeyLogInfo
+)
+
+// ErrorFunc writes an error response for status with a public message
+type ErrorFunc func(w http.ResponseWriter, r *http.Request, status int, message string)
+
+// flag values
+var (
+	flagRequestID       string
+	flagAccessLog       bool
+	flagAccessFormat    string
+	flagAccessFile      string
+	flagAccessMaxSize   int
+	flagAccessKeep      int
+	flagAccessSample    string
+	flagCompress        bool
+	flagTimeout         string
+	flagTrustedProxies  []string
+	flagRealIPHeader    string
+	flagAllowIPs        []string
+	flagDenyIPs         []string
+	flagCORSOrigins     []string
+	flagCORSCredentials bool
+)
+
+// PreInit sets up flags
+func PreInit() {
+	vflag.StringVar(&flagRequestID, "request-id-header", "X-Request-ID", "Header used to read and send request IDs. Set to empty to disable.")
+	vflag.BoolVar(&flagAccessLog, "access-log", false, "Enable this flag to log every request.")
+	vflag.StringVar(&flagAccessFormat, "access-log-format", "text", "Format of the access log: 'text', 'json', 'logfmt', or 'combined'.")
+	vflag.StringVar(&flagAccessFile, "access-log-file", "", "Write the access log to this file instead of stdout.")
+	vflag.IntVar(&flagAccessMaxSize, "access-log-max-size", 100, "Size in MB at which --access-log-file is rotated. Set to 0 to disable.")
+	vflag.IntVar(&flagAccessKeep, "access-log-keep", 5, "Number of rotated access log files to keep.")
+	vflag.StringVar(&flagAccessSample, "access-log-sample", "1", "Fraction of requests to log, such as '0.1'. Server errors are always logged.")
+	vflag.BoolVar(&flagCompress, "compress", false, "Enable this flag to compress responses with brotli or gzip.")
+	vflag.StringVar(&flagTimeout, "request-timeout", "", "Maximum duration of a request, such as '30s'. Leave empty to disable.")
+	vflag.StringArrayVar(&flagTrustedProxies, "trusted-proxy", []string{}, "IP or CIDR range of a reverse proxy whose --real-ip-header is trusted. Use 'unix' to trust every peer on a unix socket.")
+	vflag.StringVar(&flagRealIPHeader, "real-ip-header", "X-Forwarded-For", "Header the --trusted-proxy sets to the client IP, such as 'X-Forwarded-For', 'X-Real-IP', or 'Forwarded'.")
+	vflag.StringArrayVar(&flagAllowIPs, "allow-ip", []string{}, "Only allow requests from this IP or CIDR range. IPv4 and IPv6 are supported.")
+	vflag.StringArrayVar(&flagDenyIPs, "deny-ip", []string{}, "Block requests from this IP or CIDR range. IPv4 and IPv6 are supported.")
+	vflag.StringArrayVar(&flagCORSOrigins, "cors-origin", []string{}, "Origin allowed to make cross-origin requests. Use '*' to allow any.")
+	vflag.BoolVar(&flagCORSCredentials, "cors-credentials", false, "Enable this flag to allow credentials in cross-origin requests.")
+}
+
+// Defaults returns the middleware enabled by flags, in the order they should run
+func Defaults() []func(http.Handler) http.Handler {
+	res := []func(http.Handler) http.Handler{}
+	if len(flagRequestID) > 0 {
+		res = append(res, RequestID(flagRequestID))
+	}
+	if len(flagTrustedProxies) > 0 {
+		opts := RealIPOptions{Header: flagRealIPHeader}
+		cidrs := []string{}
+		for _, item := range flagTrustedProxies {
+			if item == "unix" {
+				opts.TrustUnix = true
+				continue
+			}
+			cidrs = append(cidrs, item)
+		}
+		trusted, err := ParseCIDRs(cidrs)
+		util.DieOnError(err)
+		opts.Trusted = trusted
+		res = append(res, RealIPWith(opts))
+	}
+	if flagAccessLog {
+		rate, err := strconv.ParseFloat(flagAccessSample, 64)
+		util.DieOnError(err, "invalid --access-log-sample:", flagAccessSample)
+		opts := AccessLogOptions{Format: flagAccessFormat, SampleRate: rate}
+		if len(flagAccessFile) > 0 {
+			rf, err := NewRotatingFile(flagAccessFile, int64(flagAccessMaxSize)<<20, flagAccessKeep)
+			util.DieOnError(err)
+			opts.Output = rf
+		}
+		res = append(res, AccessLogWith(opts))
+	}
+	res = append(res, Recover())
+	if len(flagAllowIPs) > 0 || len(flagDenyIPs) > 0 {
+		allow, err := ParseCIDRs(flagAllowIPs)
+		util.DieOnError(err)
+		deny, err := ParseCIDRs(flagDenyIPs)
+		util.DieOnError(err)
+		res = append(res, IPFilter(allow, deny))
+	}
+	if len(flagCORSOrigins) > 0 {
+		res = append(res, CORS(CORSOptions{
+			AllowedOrigins:   flagCORSOrigins,
+			AllowCredentials: flagCORSCredentials,
+		}))
+	}
+	if len(flagTimeout) > 0 {
+		d, err := time.ParseDuration(flagTimeout)
+		util.DieOnError(err)
+		res = append(res, Timeout(d))
+	}
+	if flagCompress {
+		res = append(res, Compress())
+	}
+	return res
+}
+
+// WithErrorFunc returns a shallow copy of r that sends errors from this package through f
+func WithErrorFunc(r *http.Request, f ErrorFunc) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), ctxKeyErrorFunc, f))
+}
+
+// Error sends an error response through the ErrorFunc set on r, or http.Error if there is none
+func Error(w http.ResponseWriter, r *http.Request, status int, message string) {
+	f, ok := r.Context().Value(ctxKeyErrorFunc).(ErrorFunc)
+	if !ok {
+		http.Error(w, message, status)
+		return
+	}
+	f(w, r, status, message)
+}
+
+// isStream returns true for requests that hold the connection open, such as
+// WebSockets and Server-Sent Events
+func isStream(r *http.Request) bool {
+	if strings.EqualFold(r.Header.Get("Connection"), "upgrade") || r.Header.Get("Upgrade") != "" {
+		return true
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// Recorder is a http.ResponseWriter that keeps track of the status and size of the response
+type Recorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+// Record wraps w in a Recorder, or returns w if it already is one
+func Record(w http.ResponseWriter) *Recorder {
+	if rec, ok := w.(*Recorder); ok {
+		return rec
+	}
+	return &Recorder{ResponseWriter: w}
+}
+
+// WriteHeader implements the http.ResponseWriter interface
+func (w *Recorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write implements the http.ResponseWriter interface
+func (w *Recorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Status returns the status code sent, or 0 if nothing has been sent yet
+func (w *Recorder) Status() int {
+	return w.status
+}
+
+// BytesWritten returns the number of body bytes sent
+func (w *Recorder) BytesWritten() int64 {
+	return w.bytes
+}
+
+// Flush implements the http.Flusher interface
+func (w *Recorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+// Hijack implements the http.Hijacker interface
+func (w *Recorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("middleware: underlying ResponseWriter does not implement http.Hijacker")
+	}
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+// Unwrap allows http.ResponseController to reach the underlying ResponseWriter
+func (w *Recorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
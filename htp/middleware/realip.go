@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ParseCIDRs parses a list of IPv4 or IPv6 CIDR ranges. Bare IPs are treated as
+// a range of one, and the legacy '192.168.x.x' form is converted to '192.168.0.0/16'.
+func ParseCIDRs(list []string) ([]*net.IPNet, error) {
+	res := []*net.IPNet{}
+	for _, item := range list {
+		item = strings.TrimSpace(item)
+		if strings.Contains(item, "x") && !strings.Contains(item, ":") {
+			s, err := patternToCIDR(item)
+			if err != nil {
+				return nil, err
+			}
+			item = s
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, &net.ParseError{Type: "IP address", Text: item}
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			res = append(res, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, n)
+	}
+	return res, nil
+}
+
+func patternToCIDR(pattern string) (string, error) {
+	octets := strings.Split(pattern, ".")
+	if len(octets) != 4 {
+		return "", &net.ParseError{Type: "IP pattern", Text: pattern}
+	}
+	bits := 0
+	for i, item := range octets {
+		if item == "x" {
+			octets[i] = "0"
+			continue
+		}
+		if bits != i*8 {
+			// only trailing 'x' octets can be expressed as a CIDR range
+			return "", &net.ParseError{Type: "IP pattern", Text: pattern}
+		}
+		bits += 8
+	}
+	return strings.Join(octets, ".") + "/" + strconv.Itoa(bits), nil
+}
+
+// ClientIP returns the IP of the peer in r.RemoteAddr
+func ClientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, item := range nets {
+		if item.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// fromUnixSocket returns true if r came in on a unix socket, whose peers are local
+// processes such as a reverse proxy
+func fromUnixSocket(r *http.Request) bool {
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	return ok && addr.Network() == "unix"
+}
+
+// RealIPOptions configures RealIPWith
+type RealIPOptions struct {
+	Trusted   []*net.IPNet // ranges of the reverse proxies whose header is read
+	TrustUnix bool         // also trust every peer on a unix socket
+	Header    string       // header set by the proxy. Defaults to 'X-Forwarded-For'.
+}
+
+// RealIP sets r.RemoteAddr to the client IP in the X-Forwarded-For header when
+// the request came from one of the trusted proxy ranges
+func RealIP(trusted []*net.IPNet) func(http.Handler) http.Handler {
+	return RealIPWith(RealIPOptions{Trusted: trusted})
+}
+
+// RealIPWith sets r.RemoteAddr to the client IP in opts.Header, but only when the
+// request came from one of the trusted proxy ranges, or over a unix socket if
+// opts.TrustUnix is set. Only the
+// header the proxy is set up to write is read, since proxies pass other forwarding
+// headers through from the client unchanged. The hops are read right to left and
+// the first one that is not itself a trusted proxy is used, so that clients can not
+// spoof their address by sending the header themselves.
+func RealIPWith(opts RealIPOptions) func(http.Handler) http.Handler {
+	if len(opts.Header) == 0 {
+		opts.Header = "X-Forwarded-For"
+	}
+	trusted := opts.Trusted
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := ClientIP(r)
+			if !(opts.TrustUnix && fromUnixSocket(r)) && (ip == nil || !containsIP(trusted, ip)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ip = nil
+			hops := forwardedHops(r, opts.Header)
+			for i := len(hops) - 1; i >= 0; i-- {
+				hop := net.ParseIP(hops[i])
+				if hop == nil {
+					break
+				}
+				ip = hop
+				if !containsIP(trusted, hop) {
+					break
+				}
+			}
+			if ip == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			r2 := r.Clone(r.Context())
+			r2.RemoteAddr = net.JoinHostPort(ip.String(), "0")
+			next.ServeHTTP(w, r2)
+		})
+	}
+}
+
+// forwardedHops returns the addresses in header, in the order they were added. The
+// RFC 7239 Forwarded header is parsed for its 'for' pairs and any other header is
+// read as a comma separated list, as in X-Forwarded-For and X-Real-IP.
+func forwardedHops(r *http.Request, header string) []string {
+	res := []string{}
+	values := strings.Join(r.Header.Values(header), ",")
+	if !strings.EqualFold(header, "Forwarded") {
+		for _, item := range strings.Split(values, ",") {
+			if item = strings.TrimSpace(item); len(item) > 0 {
+				res = append(res, item)
+			}
+		}
+		return res
+	}
+	for _, item := range strings.Split(values, ",") {
+		for _, pair := range strings.Split(item, ";") {
+			kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			if len(kv) != 2 || !strings.EqualFold(kv[0], "for") {
+				continue
+			}
+			v := strings.Trim(kv[1], `"`)
+			if host, _, err := net.SplitHostPort(v); err == nil {
+				v = host
+			}
+			res = append(res, strings.TrimSuffix(strings.TrimPrefix(v, "["), "]"))
+		}
+	}
+	return res
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseCIDRs(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string // "" if in is invalid
+	}{
+		{"10.0.0.0/8", "10.0.0.0/8"},
+		{"192.168.1.5", "192.168.1.5/32"},
+		{" 192.168.1.5 ", "192.168.1.5/32"},
+		{"192.168.x.x", "192.168.0.0/16"},
+		{"10.x.x.x", "10.0.0.0/8"},
+		{"x.x.x.x", "0.0.0.0/0"},
+		{"::1", "::1/128"},
+		{"2001:db8::/32", "2001:db8::/32"},
+		{"192.x.1.x", ""},
+		{"192.168.x", ""},
+		{"10.0.0.0/33", ""},
+		{"localhost", ""},
+	}
+	for _, tc := range cases {
+		res, err := ParseCIDRs([]string{tc.in})
+		if len(tc.want) == 0 {
+			if err == nil {
+				t.Errorf("ParseCIDRs(%q) = %v, want an error", tc.in, res)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseCIDRs(%q): %v", tc.in, err)
+			continue
+		}
+		if got := res[0].String(); got != tc.want {
+			t.Errorf("ParseCIDRs(%q) = %s, want %s", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestRealIP(t *testing.T) {
+	trusted, err := ParseCIDRs([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name   string
+		remote string
+		unix   bool
+		trust  bool
+		header string
+		xff    string
+		fwd    string
+		want   string
+	}{
+		{"untrusted peer is kept", "203.0.113.1:1234", false, false, "", "198.51.100.7", "", "203.0.113.1"},
+		{"trusted peer is replaced", "10.0.0.1:1234", false, false, "", "198.51.100.7", "", "198.51.100.7"},
+		{"hops left of the client are ignored", "10.0.0.1:1234", false, false, "", "1.2.3.4, 198.51.100.7", "", "198.51.100.7"},
+		{"chained proxies are skipped", "10.0.0.1:1234", false, false, "", "198.51.100.7, 10.0.0.2", "", "198.51.100.7"},
+		{"invalid hop stops the walk", "10.0.0.1:1234", false, false, "", "198.51.100.7, junk", "", "10.0.0.1"},
+		{"trusted peer without headers", "10.0.0.1:1234", false, false, "", "", "", "10.0.0.1"},
+		{"client sent forwarded is ignored", "10.0.0.1:1234", false, false, "", "198.51.100.7", "for=1.2.3.4", "198.51.100.7"},
+		{"client sent forwarded is ignored without xff", "10.0.0.1:1234", false, false, "", "", "for=1.2.3.4", "10.0.0.1"},
+		{"forwarded when configured", "10.0.0.1:1234", false, false, "Forwarded", "1.2.3.4", `for=198.51.100.7, for="[2001:db8::1]:4711"`, "2001:db8::1"},
+		{"client sent xff is ignored when forwarded is configured", "10.0.0.1:1234", false, false, "Forwarded", "1.2.3.4", "", "10.0.0.1"},
+		{"xff is ignored when x-real-ip is configured", "10.0.0.1:1234", false, false, "X-Real-IP", "1.2.3.4", "", "10.0.0.1"},
+		{"unix socket peer is trusted when enabled", "@", true, true, "", "198.51.100.7", "", "198.51.100.7"},
+		{"unix socket peer without headers", "@", true, true, "", "", "", "<nil>"},
+		{"unix socket peer is not trusted by default", "@", true, false, "", "198.51.100.7", "", "<nil>"},
+		{"untrusted peer may not claim a unix socket", "203.0.113.1:1234", false, false, "", "", `for=unix`, "203.0.113.1"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := ""
+			h := RealIPWith(RealIPOptions{Trusted: trusted, TrustUnix: tc.trust, Header: tc.header})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = ClientIP(r).String()
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tc.remote
+			if tc.unix {
+				r = r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, &net.UnixAddr{Name: "/run/app.sock", Net: "unix"}))
+			}
+			if len(tc.xff) > 0 {
+				r.Header.Set("X-Forwarded-For", tc.xff)
+			}
+			if len(tc.fwd) > 0 {
+				r.Header.Set("Forwarded", tc.fwd)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			if got != tc.want {
+				t.Errorf("client ip = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestIPFilter(t *testing.T) {
+	allow, _ := ParseCIDRs([]string{"10.0.0.0/8", "2001:db8::/32"})
+	deny, _ := ParseCIDRs([]string{"10.0.0.66"})
+	cases := []struct {
+		remote string
+		want   int
+	}{
+		{"10.1.2.3:80", http.StatusOK},
+		{"10.0.0.66:80", http.StatusForbidden},
+		{"[2001:db8::1]:80", http.StatusOK},
+		{"203.0.113.1:80", http.StatusForbidden},
+		{"@", http.StatusForbidden},
+	}
+	h := IPFilter(allow, deny)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, tc := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tc.remote
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d", tc.remote, rec.Code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"github.com/nektro/go-util/util"
+)
+
+// Recover turns panics into a 500 response and logs them along with their stack trace
+func Recover() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				rcv := recover()
+				if rcv == nil {
+					return
+				}
+				if rcv == http.ErrAbortHandler {
+					panic(rcv)
+				}
+				util.LogError("htp:", "panic:", r.Method, r.URL.Path, GetRequestID(r), rcv, "\n"+string(debug.Stack()))
+				Error(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"os"
+	"strconv"
+	"sync"
+)
+
+// RotatingFile is an io.Writer that appends to a file, which is moved to
+// 'name.1' when it grows past a size. Older files are shifted up to 'name.N'.
+type RotatingFile struct {
+	name    string
+	maxSize int64
+	keep    int
+	f       *os.File
+	size    int64
+	mtx     sync.Mutex
+}
+
+// NewRotatingFile opens name for appending. It is rotated after it reaches maxSize
+// bytes and keep old files are kept.
+func NewRotatingFile(name string, maxSize int64, keep int) (*RotatingFile, error) {
+	rf := &RotatingFile{name: name, maxSize: maxSize, keep: keep}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *RotatingFile) open() error {
+	f, err := os.OpenFile(rf.name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.f, rf.size = f, stat.Size()
+	return nil
+}
+
+// Write implements the io.Writer interface
+func (rf *RotatingFile) Write(b []byte) (int, error) {
+	rf.mtx.Lock()
+	defer rf.mtx.Unlock()
+
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(b)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := rf.f.Write(b)
+	rf.size += int64(n)
+	return n, err
+}
+
+func (rf *RotatingFile) rotate() error {
+	rf.f.Close()
+	if rf.keep > 0 {
+		for i := rf.keep - 1; i > 0; i-- {
+			os.Rename(rf.name+"."+strconv.Itoa(i), rf.name+"."+strconv.Itoa(i+1))
+		}
+		os.Rename(rf.name, rf.name+".1")
+	} else {
+		os.Remove(rf.name)
+	}
+	return rf.open()
+}
+
+// Close closes the current file
+func (rf *RotatingFile) Close() error {
+	rf.mtx.Lock()
+	defer rf.mtx.Unlock()
+	return rf.f.Close()
+}
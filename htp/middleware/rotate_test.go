@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	cases := []struct {
+		name   string
+		keep   int
+		before string // contents of the file when it is opened
+		writes []string
+		want   map[string]string // contents of every file in the dir after the writes
+	}{
+		{"under the limit", 2, "", []string{"aaaa", "bbbb"}, map[string]string{
+			"log": "aaaabbbb",
+		}},
+		{"rotates past the limit", 2, "", []string{"aaaa", "bbbb", "cccc"}, map[string]string{
+			"log":   "cccc",
+			"log.1": "aaaabbbb",
+		}},
+		{"drops files past keep", 2, "", []string{"aaaaaaaa", "bbbbbbbb", "cccccccc", "dddddddd"}, map[string]string{
+			"log":   "dddddddd",
+			"log.1": "cccccccc",
+			"log.2": "bbbbbbbb",
+		}},
+		{"keep 0 removes the old file", 0, "", []string{"aaaaaaaa", "bbbbbbbb"}, map[string]string{
+			"log": "bbbbbbbb",
+		}},
+		{"large write to an empty file", 2, "", []string{"aaaaaaaaaaaa", "bb"}, map[string]string{
+			"log":   "bb",
+			"log.1": "aaaaaaaaaaaa",
+		}},
+		{"counts what was already in the file", 2, "aaaaaaaa", []string{"bbbb"}, map[string]string{
+			"log":   "bbbb",
+			"log.1": "aaaaaaaa",
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			name := filepath.Join(dir, "log")
+			if len(tc.before) > 0 {
+				if err := os.WriteFile(name, []byte(tc.before), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			rf, err := NewRotatingFile(name, 10, tc.keep)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, item := range tc.writes {
+				if n, err := rf.Write([]byte(item)); err != nil || n != len(item) {
+					t.Fatalf("Write(%q) = %d, %v", item, n, err)
+				}
+			}
+			if err := rf.Close(); err != nil {
+				t.Fatal(err)
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]string{}
+			for _, item := range entries {
+				b, err := os.ReadFile(filepath.Join(dir, item.Name()))
+				if err != nil {
+					t.Fatal(err)
+				}
+				got[item.Name()] = string(b)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("files = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+)
+
+// Timeout ends requests that take longer than d with a 503. WebSocket and
+// Server-Sent Events requests are not limited.
+func Timeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		th := http.TimeoutHandler(next, d, http.StatusText(http.StatusServiceUnavailable))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isStream(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			th.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,528 @@
+package htp
+
+import (
+	"encoding"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nektro/go-util/vflag"
+)
+
+// Name is the title of the document served at /openapi.json. etc sets it to etc.AppID.
+var Name = ""
+
+var (
+	flagOpenAPI   bool
+	flagOpenAPIUI bool
+)
+
+func openapiPreInit() {
+	vflag.BoolVar(&flagOpenAPI, "openapi", false, "Enable this flag to serve an OpenAPI 3 document of the registered routes at /openapi.json.")
+	vflag.BoolVar(&flagOpenAPIUI, "openapi-ui", false, "Enable this flag to serve a page that displays /openapi.json at /docs.")
+}
+
+// RouteDoc describes a route in the document served at /openapi.json
+type RouteDoc struct {
+	Summary      string
+	Description  string
+	Tags         []string
+	RequestBody  interface{} // a value of the type decoded by BindJSON, which sets it if it is nil
+	ResponseBody interface{} // a value of the type sent back as json
+	Params       []Param     // params read by the Controller getters are added as they are seen
+	Auth         bool        // set automatically on routes behind RequireJWT
+	Hidden       bool        // leave this route out of the document
+}
+
+// Param describes a query, path, or form value of a route
+type Param struct {
+	Name     string
+	In       string // 'query', 'path', or 'form'
+	Type     string // a JSON Schema type, defaults to 'string'
+	Format   string
+	Enum     []string
+	Required bool
+}
+
+// RouteOption sets part of the RouteDoc of a route, or how it is served, when it is registered
+type RouteOption func(ri *routeInfo)
+
+// Summary sets the summary, and optionally the description, of a route
+func Summary(summary string, description ...string) RouteOption {
+	return func(ri *routeInfo) {
+		ri.doc.Summary = summary
+		ri.doc.Description = strings.Join(description, "\n\n")
+	}
+}
+
+// Tags groups a route with others under tags
+func Tags(tags ...string) RouteOption {
+	return func(ri *routeInfo) {
+		ri.doc.Tags = append(ri.doc.Tags, tags...)
+	}
+}
+
+// RequestBody sets the json request body of a route to the type of v
+func RequestBody(v interface{}) RouteOption {
+	return func(ri *routeInfo) {
+		ri.doc.RequestBody = v
+	}
+}
+
+// ResponseBody sets the json response body of a route to the type of v
+func ResponseBody(v interface{}) RouteOption {
+	return func(ri *routeInfo) {
+		ri.doc.ResponseBody = v
+	}
+}
+
+// Params adds params to a route that are not read through the Controller getters
+func Params(params ...Param) RouteOption {
+	return func(ri *routeInfo) {
+		ri.doc.Params = append(ri.doc.Params, params...)
+	}
+}
+
+// Auth marks a route as requiring a JWT
+func Auth() RouteOption {
+	return func(ri *routeInfo) {
+		ri.doc.Auth = true
+	}
+}
+
+// Hidden leaves a route out of the document
+func Hidden() RouteOption {
+	return func(ri *routeInfo) {
+		ri.doc.Hidden = true
+	}
+}
+
+// routeInfo is a registered route along with what has been learned about it
+type routeInfo struct {
+	method string
+	path   string // OpenAPI path template, relative to Base()
+	mtx    sync.Mutex
+	doc    RouteDoc
+	seen   sync.Map // noteKey of every note made, so that getters only lock the first time
+
+	csrfExempt bool   // set by CSRFExempt
+	maxBody    *int64 // set by BodyLimit
+}
+
+// noteKey is a fact about a param. what is "", "required", "enum", or the type of the param.
+type noteKey struct {
+	in, name, what, format string
+}
+
+var pathVarRe = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+func newRouteInfo(method, path string, opts []RouteOption) *routeInfo {
+	ri := &routeInfo{method: method, path: pathVarRe.ReplaceAllString(path, "{$1}")}
+	for _, item := range opts {
+		item(ri)
+	}
+	if len(method) == 0 || strings.HasSuffix(path, "/*") {
+		ri.doc.Hidden = true
+	}
+	for _, item := range pathVarRe.FindAllStringSubmatch(path, -1) {
+		ri.note(noteKey{"path", item[1], "required", ""}, func(p *Param) {
+			p.Required = true
+		})
+	}
+	return ri
+}
+
+// note adds the param in k to this route if it is new and passes it to f, unless
+// k has been noted before
+func (ri *routeInfo) note(k noteKey, f func(p *Param)) {
+	if _, ok := ri.seen.Load(k); ok {
+		return
+	}
+	ri.mtx.Lock()
+	defer ri.mtx.Unlock()
+	var p *Param
+	for i, item := range ri.doc.Params {
+		if item.In == k.in && item.Name == k.name {
+			p = &ri.doc.Params[i]
+		}
+	}
+	if p == nil {
+		ri.doc.Params = append(ri.doc.Params, Param{Name: k.name, In: k.in})
+		p = &ri.doc.Params[len(ri.doc.Params)-1]
+	}
+	if f != nil {
+		f(p)
+	}
+	ri.seen.Store(k, true)
+}
+
+func (ri *routeInfo) setRequestBody(v interface{}) {
+	ri.mtx.Lock()
+	if ri.doc.RequestBody == nil {
+		ri.doc.RequestBody = v
+	}
+	ri.mtx.Unlock()
+}
+
+func (ri *routeInfo) setAuth() {
+	ri.mtx.Lock()
+	ri.doc.Auth = true
+	ri.mtx.Unlock()
+}
+
+// note records that this request's route reads the param name from src. See noteKey for what.
+func (v *Controller) note(src paramSource, name, what string, f func(p *Param)) {
+	if v.route != nil {
+		v.route.note(noteKey{src.String(), name, what, ""}, f)
+	}
+}
+
+func (v *Controller) noteType(src paramSource, name, typ, format string) {
+	if v.route != nil {
+		v.route.note(noteKey{src.String(), name, typ, format}, func(p *Param) {
+			p.Type, p.Format = typ, format
+		})
+	}
+}
+
+// OpenAPI returns an OpenAPI 3 document of the routes registered on this server.
+// Params are added to it as they are read through the Controller getters.
+func (s *Server) OpenAPI() map[string]interface{} {
+	s.routesMtx.Lock()
+	routes := append([]*routeInfo{}, s.routes...)
+	s.routesMtx.Unlock()
+
+	g := &schemaGen{map[string]interface{}{
+		"Problem": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"type":     map[string]interface{}{"type": "string"},
+				"title":    map[string]interface{}{"type": "string"},
+				"status":   map[string]interface{}{"type": "integer"},
+				"detail":   map[string]interface{}{"type": "string"},
+				"instance": map[string]interface{}{"type": "string"},
+			},
+		},
+	}}
+	paths := map[string]interface{}{}
+	for _, item := range routes {
+		item.mtx.Lock()
+		doc := item.doc
+		doc.Params = append([]Param{}, doc.Params...)
+		item.mtx.Unlock()
+		if doc.Hidden {
+			continue
+		}
+		p, ok := paths[item.path].(map[string]interface{})
+		if !ok {
+			p = map[string]interface{}{}
+			paths[item.path] = p
+		}
+		p[strings.ToLower(item.method)] = g.operation(doc)
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   Name,
+			"version": Version,
+		},
+		"servers": []interface{}{
+			map[string]interface{}{"url": s.opts.Base},
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": g.components,
+			"securitySchemes": map[string]interface{}{
+				"jwt": map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+	}
+}
+
+func (g *schemaGen) operation(doc RouteDoc) map[string]interface{} {
+	op := map[string]interface{}{}
+	if len(doc.Summary) > 0 {
+		op["summary"] = doc.Summary
+	}
+	if len(doc.Description) > 0 {
+		op["description"] = doc.Description
+	}
+	if len(doc.Tags) > 0 {
+		op["tags"] = doc.Tags
+	}
+	if doc.Auth {
+		op["security"] = []interface{}{map[string]interface{}{"jwt": []string{}}}
+	}
+
+	params := []interface{}{}
+	form := map[string]interface{}{}
+	formRequired := []string{}
+	for _, item := range doc.Params {
+		if item.In == "form" {
+			form[item.Name] = paramSchema(item)
+			if item.Required {
+				formRequired = append(formRequired, item.Name)
+			}
+			continue
+		}
+		params = append(params, map[string]interface{}{
+			"name":     item.Name,
+			"in":       item.In,
+			"required": item.Required,
+			"schema":   paramSchema(item),
+		})
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	content := map[string]interface{}{}
+	if doc.RequestBody != nil {
+		content["application/json"] = map[string]interface{}{"schema": g.schema(reflect.TypeOf(doc.RequestBody))}
+	}
+	if len(form) > 0 {
+		schema := map[string]interface{}{"type": "object", "properties": form}
+		if len(formRequired) > 0 {
+			schema["required"] = formRequired
+		}
+		content["application/x-www-form-urlencoded"] = map[string]interface{}{"schema": schema}
+		content["multipart/form-data"] = map[string]interface{}{"schema": schema}
+	}
+	if len(content) > 0 {
+		op["requestBody"] = map[string]interface{}{"required": doc.RequestBody != nil, "content": content}
+	}
+
+	ok := map[string]interface{}{"description": "OK"}
+	if doc.ResponseBody != nil {
+		ok["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": g.schema(reflect.TypeOf(doc.ResponseBody))},
+		}
+	}
+	op["responses"] = map[string]interface{}{
+		"200": ok,
+		"default": map[string]interface{}{
+			"description": "Error",
+			"content": map[string]interface{}{
+				"application/problem+json": map[string]interface{}{"schema": map[string]interface{}{"$ref": "#/components/schemas/Problem"}},
+			},
+		},
+	}
+	return op
+}
+
+func paramSchema(p Param) map[string]interface{} {
+	typ := p.Type
+	if len(typ) == 0 {
+		typ = "string"
+	}
+	res := map[string]interface{}{"type": typ}
+	if typ == "array" {
+		res["items"] = map[string]interface{}{"type": "string"}
+	}
+	if len(p.Format) > 0 {
+		res["format"] = p.Format
+	}
+	if len(p.Enum) > 0 {
+		res["enum"] = p.Enum
+	}
+	return res
+}
+
+// schemaGen makes JSON Schemas of Go types. Named structs are added to components
+// and referenced by name.
+type schemaGen struct {
+	components map[string]interface{}
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+func (g *schemaGen) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t.ConvertibleTo(timeType):
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case reflect.PtrTo(t).Implements(textMarshalerType):
+		return map[string]interface{}{"type": "string"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if len(t.Name()) == 0 {
+			return g.object(t)
+		}
+		if _, ok := g.components[t.Name()]; !ok {
+			// reserved first so that recursive types end
+			g.components[t.Name()] = map[string]interface{}{}
+			g.components[t.Name()] = g.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]interface{}{}
+}
+
+func (g *schemaGen) object(t reflect.Type) map[string]interface{} {
+	props := map[string]interface{}{}
+	required := []string{}
+	g.fields(t, props, &required)
+	res := map[string]interface{}{"type": "object", "properties": props}
+	if len(required) > 0 {
+		sort.Strings(required)
+		res["required"] = required
+	}
+	return res
+}
+
+func (g *schemaGen) fields(t reflect.Type, props map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := fieldName(f)
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && len(f.Tag.Get("json")) == 0 {
+			// embedded fields are flattened by encoding/json
+			g.fields(f.Type, props, required)
+			continue
+		}
+		schema := g.schema(f.Type)
+		for _, item := range splitRules(f.Tag.Get("validate")) {
+			if item == "required" {
+				*required = append(*required, name)
+				continue
+			}
+			kv := strings.SplitN(item, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			applyRule(schema, kv[0], kv[1])
+		}
+		props[name] = schema
+	}
+}
+
+// applyRule adds the JSON Schema form of a `validate` rule to schema
+func applyRule(schema map[string]interface{}, rule, arg string) {
+	if _, ok := schema["$ref"]; ok {
+		return
+	}
+	switch rule {
+	case "min", "max":
+		n, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return
+		}
+		typ, _ := schema["type"].(string)
+		key := map[string]string{"string": "Length", "array": "Items", "object": "Properties"}[typ]
+		if len(key) == 0 {
+			schema[map[string]string{"min": "minimum", "max": "maximum"}[rule]] = n
+			return
+		}
+		schema[rule+key] = int(n)
+	case "oneof":
+		schema["enum"] = strings.Fields(arg)
+	case "regex":
+		schema["pattern"] = arg
+	}
+}
+
+// registerOpenAPI adds /openapi.json and, if ui is true, /docs
+func (s *Server) registerOpenAPI(ui bool) {
+	s.register("/openapi.json", http.MethodGet, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.OpenAPI())
+	}), nil, []RouteOption{Hidden()})
+	if !ui {
+		return
+	}
+	s.register("/docs", http.MethodGet, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce := CSPNonce(r)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(strings.ReplaceAll(openapiPage, "{nonce}", nonce)))
+	}), nil, []RouteOption{Hidden()})
+}
+
+// openapiPage renders /openapi.json in the browser
+const openapiPage = `<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>API</title>
+	<style nonce="{nonce}">
+		body { font-family: sans-serif; max-width: 960px; margin: 2em auto; padding: 0 1em; }
+		details { border: 1px solid #ccc; border-radius: 4px; margin: .5em 0; padding: .5em; }
+		summary { cursor: pointer; }
+		.method { display: inline-block; width: 5em; font-weight: bold; text-transform: uppercase; }
+		.get { color: #2a7; } .post { color: #27a; } .put, .patch { color: #a72; } .delete { color: #a22; }
+		pre { background: #f4f4f4; padding: .5em; overflow: auto; }
+		table { border-collapse: collapse; } td, th { border: 1px solid #ddd; padding: .2em .5em; text-align: left; }
+	</style>
+</head>
+<body>
+	<h1 id="title">API</h1>
+	<div id="paths"></div>
+	<h2>Schemas</h2>
+	<div id="schemas"></div>
+	<script nonce="{nonce}">
+	"use strict";
+	const el = (tag, attrs, ...children) => {
+		const e = document.createElement(tag);
+		Object.assign(e, attrs);
+		e.append(...children);
+		return e;
+	};
+	const json = (v) => el("pre", {}, JSON.stringify(v, null, 2));
+	fetch("openapi.json").then((r) => r.json()).then((doc) => {
+		document.title = doc.info.title + " " + doc.info.version;
+		document.getElementById("title").textContent = document.title;
+		const paths = document.getElementById("paths");
+		for (const path of Object.keys(doc.paths).sort()) {
+			for (const [method, op] of Object.entries(doc.paths[path])) {
+				const body = [];
+				if (op.description) body.push(el("p", {}, op.description));
+				if (op.security) body.push(el("p", {}, "Requires a JWT."));
+				if (op.parameters) {
+					const rows = op.parameters.map((p) => el("tr", {}, el("td", {}, p.name), el("td", {}, p.in), el("td", {}, p.schema.type + (p.schema.format ? " (" + p.schema.format + ")" : "")), el("td", {}, p.required ? "required" : "")));
+					body.push(el("table", {}, el("tr", {}, el("th", {}, "name"), el("th", {}, "in"), el("th", {}, "type"), el("th", {})), ...rows));
+				}
+				if (op.requestBody) body.push(el("h4", {}, "Request"), json(op.requestBody.content));
+				if (op.responses["200"].content) body.push(el("h4", {}, "Response"), json(op.responses["200"].content));
+				paths.append(el("details", {}, el("summary", {}, el("span", {className: "method " + method}, method), path + (op.summary ? " — " + op.summary : "")), ...body));
+			}
+		}
+		const schemas = document.getElementById("schemas");
+		for (const [name, schema] of Object.entries(doc.components.schemas)) {
+			schemas.append(el("details", {id: name}, el("summary", {}, name), json(schema)));
+		}
+	});
+	</script>
+</body>
+</html>
+`
@@ -0,0 +1,409 @@
+package htp
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nektro/go.etc/dbt"
+)
+
+// paramSource is where in the request a value is read from
+type paramSource int
+
+// param sources
+const (
+	srcQuery paramSource = iota
+	srcForm
+	srcPath
+)
+
+func (s paramSource) String() string {
+	return [...]string{"query", "form", "path"}[s]
+}
+
+// timeFormats are tried in order by the *Time getters
+var timeFormats = []string{time.RFC3339, dbt.TimeFormat, "2006-01-02"}
+
+func (v *Controller) values(src paramSource, name string) []string {
+	v.note(src, name, "", nil)
+	switch src {
+	case srcQuery:
+		return v.r.URL.Query()[name]
+	case srcForm:
+		v.AssertCSRF()
+		v.parseForm()
+		return v.r.Form[name]
+	case srcPath:
+		s, ok := mux.Vars(v.r)[name]
+		if !ok {
+			return nil
+		}
+		return []string{s}
+	}
+	return nil
+}
+
+// parseForm fills in r.Form, exiting with a 413 if the body is too large
+func (v *Controller) parseForm() {
+	if v.r.Form != nil {
+		return
+	}
+	// ParseMultipartForm drops the error from ParseForm on non-multipart bodies
+	err := v.r.ParseForm()
+	if err == nil {
+		err = v.r.ParseMultipartForm(32 << 20)
+	}
+	if he := bodyError(err); he != nil {
+		v.Abort(he)
+	}
+}
+
+// param returns the value of name and whether it was present and non-empty
+func (v *Controller) param(src paramSource, name string) (string, bool) {
+	a := v.values(src, name)
+	if len(a) == 0 || len(a[0]) == 0 {
+		return "", false
+	}
+	return a[0], true
+}
+
+func (v *Controller) mustParam(src paramSource, name string) string {
+	v.note(src, name, "required", func(p *Param) {
+		p.Required = true
+	})
+	s, ok := v.param(src, name)
+	v.AssertStatus(ok, http.StatusBadRequest, "missing "+src.String()+" value: "+name)
+	return s
+}
+
+func (v *Controller) assertParam(condition bool, src paramSource, name, what string) {
+	v.AssertStatus(condition, http.StatusBadRequest, src.String()+" value must be "+what+": "+name)
+}
+
+func (v *Controller) parseInt(src paramSource, name, s string) int64 {
+	v.noteType(src, name, "integer", "int64")
+	n, err := strconv.ParseInt(s, 10, 64)
+	v.assertParam(err == nil, src, name, "a number")
+	return n
+}
+
+func (v *Controller) parseBool(src paramSource, name, s string) bool {
+	v.noteType(src, name, "boolean", "")
+	b, err := strconv.ParseBool(s)
+	v.assertParam(err == nil, src, name, "a boolean")
+	return b
+}
+
+func (v *Controller) parseFloat(src paramSource, name, s string) float64 {
+	v.noteType(src, name, "number", "")
+	f, err := strconv.ParseFloat(s, 64)
+	v.assertParam(err == nil, src, name, "a decimal number")
+	return f
+}
+
+func (v *Controller) parseDuration(src paramSource, name, s string) time.Duration {
+	v.noteType(src, name, "string", "duration")
+	d, err := time.ParseDuration(s)
+	v.assertParam(err == nil, src, name, "a duration")
+	return d
+}
+
+func (v *Controller) parseTime(src paramSource, name, s string) time.Time {
+	v.noteType(src, name, "string", "date-time")
+	for _, item := range timeFormats {
+		t, err := time.Parse(item, s)
+		if err == nil {
+			return t
+		}
+	}
+	v.assertParam(false, src, name, "a time")
+	return time.Time{}
+}
+
+func (v *Controller) parseUUID(src paramSource, name, s string) dbt.UUID {
+	v.noteType(src, name, "string", "uuid")
+	u := dbt.UUID(s)
+	v.assertParam(dbt.IsUUID(u), src, name, "a uuid")
+	return u
+}
+
+func (v *Controller) parseEnum(src paramSource, name, s string, options []string) string {
+	v.note(src, name, "enum", func(p *Param) {
+		p.Enum = options
+	})
+	for _, item := range options {
+		if s == item {
+			return s
+		}
+	}
+	v.assertParam(false, src, name, "one of: "+strings.Join(options, ", "))
+	return ""
+}
+
+// list merges repeated keys and comma separated values, dropping empty items
+func (v *Controller) list(src paramSource, name string) []string {
+	v.noteType(src, name, "array", "")
+	res := []string{}
+	for _, item := range v.values(src, name) {
+		for _, jtem := range strings.Split(item, ",") {
+			jtem = strings.TrimSpace(jtem)
+			if len(jtem) > 0 {
+				res = append(res, jtem)
+			}
+		}
+	}
+	return res
+}
+
+func (v *Controller) mustList(src paramSource, name string) []string {
+	v.note(src, name, "required", func(p *Param) {
+		p.Required = true
+	})
+	l := v.list(src, name)
+	v.AssertStatus(len(l) > 0, http.StatusBadRequest, "missing "+src.String()+" value: "+name)
+	return l
+}
+
+// GetQueryInt returns the query value name and its value as a number
+func (v *Controller) GetQueryInt(name string) (string, int64) {
+	s := v.GetQueryString(name)
+	return s, v.parseInt(srcQuery, name, s)
+}
+
+// GetQueryBool returns the query value name as a boolean
+func (v *Controller) GetQueryBool(name string) bool {
+	return v.parseBool(srcQuery, name, v.mustParam(srcQuery, name))
+}
+
+// GetQueryFloat returns the query value name as a decimal number
+func (v *Controller) GetQueryFloat(name string) float64 {
+	return v.parseFloat(srcQuery, name, v.mustParam(srcQuery, name))
+}
+
+// GetQueryDuration returns the query value name as a duration such as '1h30m'
+func (v *Controller) GetQueryDuration(name string) time.Duration {
+	return v.parseDuration(srcQuery, name, v.mustParam(srcQuery, name))
+}
+
+// GetQueryTime returns the query value name as a time in RFC3339, dbt.TimeFormat, or '2006-01-02' format
+func (v *Controller) GetQueryTime(name string) time.Time {
+	return v.parseTime(srcQuery, name, v.mustParam(srcQuery, name))
+}
+
+// GetQueryUUID returns the query value name as a dbt.UUID
+func (v *Controller) GetQueryUUID(name string) dbt.UUID {
+	return v.parseUUID(srcQuery, name, v.mustParam(srcQuery, name))
+}
+
+// GetQueryEnum returns the query value name, which must be one of options
+func (v *Controller) GetQueryEnum(name string, options ...string) string {
+	return v.parseEnum(srcQuery, name, v.mustParam(srcQuery, name), options)
+}
+
+// GetQueryList returns the query value name split on commas. Repeated keys are merged.
+func (v *Controller) GetQueryList(name string) []string {
+	return v.mustList(srcQuery, name)
+}
+
+// OptQueryString returns the query value name, or def if it is not present
+func (v *Controller) OptQueryString(name string, def string) string {
+	s, ok := v.param(srcQuery, name)
+	if !ok {
+		return def
+	}
+	return s
+}
+
+// OptQueryInt returns the query value name as a number, or def if it is not present
+func (v *Controller) OptQueryInt(name string, def int64) int64 {
+	s, ok := v.param(srcQuery, name)
+	if !ok {
+		return def
+	}
+	return v.parseInt(srcQuery, name, s)
+}
+
+// OptQueryBool returns the query value name as a boolean, or def if it is not present
+func (v *Controller) OptQueryBool(name string, def bool) bool {
+	s, ok := v.param(srcQuery, name)
+	if !ok {
+		return def
+	}
+	return v.parseBool(srcQuery, name, s)
+}
+
+// OptQueryFloat returns the query value name as a decimal number, or def if it is not present
+func (v *Controller) OptQueryFloat(name string, def float64) float64 {
+	s, ok := v.param(srcQuery, name)
+	if !ok {
+		return def
+	}
+	return v.parseFloat(srcQuery, name, s)
+}
+
+// OptQueryDuration returns the query value name as a duration, or def if it is not present
+func (v *Controller) OptQueryDuration(name string, def time.Duration) time.Duration {
+	s, ok := v.param(srcQuery, name)
+	if !ok {
+		return def
+	}
+	return v.parseDuration(srcQuery, name, s)
+}
+
+// OptQueryTime returns the query value name as a time, or def if it is not present
+func (v *Controller) OptQueryTime(name string, def time.Time) time.Time {
+	s, ok := v.param(srcQuery, name)
+	if !ok {
+		return def
+	}
+	return v.parseTime(srcQuery, name, s)
+}
+
+// OptQueryEnum returns the query value name, which must be one of options, or def if it is not present
+func (v *Controller) OptQueryEnum(name string, def string, options ...string) string {
+	s, ok := v.param(srcQuery, name)
+	if !ok {
+		return def
+	}
+	return v.parseEnum(srcQuery, name, s, options)
+}
+
+// OptQueryList returns the query value name split on commas, or def if it is not present
+func (v *Controller) OptQueryList(name string, def []string) []string {
+	l := v.list(srcQuery, name)
+	if len(l) == 0 {
+		return def
+	}
+	return l
+}
+
+// GetFormBool returns the form value name as a boolean
+func (v *Controller) GetFormBool(name string) bool {
+	return v.parseBool(srcForm, name, v.mustParam(srcForm, name))
+}
+
+// GetFormFloat returns the form value name as a decimal number
+func (v *Controller) GetFormFloat(name string) float64 {
+	return v.parseFloat(srcForm, name, v.mustParam(srcForm, name))
+}
+
+// GetFormDuration returns the form value name as a duration such as '1h30m'
+func (v *Controller) GetFormDuration(name string) time.Duration {
+	return v.parseDuration(srcForm, name, v.mustParam(srcForm, name))
+}
+
+// GetFormTime returns the form value name as a time in RFC3339, dbt.TimeFormat, or '2006-01-02' format
+func (v *Controller) GetFormTime(name string) time.Time {
+	return v.parseTime(srcForm, name, v.mustParam(srcForm, name))
+}
+
+// GetFormUUID returns the form value name as a dbt.UUID
+func (v *Controller) GetFormUUID(name string) dbt.UUID {
+	return v.parseUUID(srcForm, name, v.mustParam(srcForm, name))
+}
+
+// GetFormEnum returns the form value name, which must be one of options
+func (v *Controller) GetFormEnum(name string, options ...string) string {
+	return v.parseEnum(srcForm, name, v.mustParam(srcForm, name), options)
+}
+
+// GetFormList returns the form value name split on commas. Repeated keys are merged.
+func (v *Controller) GetFormList(name string) []string {
+	return v.mustList(srcForm, name)
+}
+
+// OptFormString returns the form value name, or def if it is not present
+func (v *Controller) OptFormString(name string, def string) string {
+	s, ok := v.param(srcForm, name)
+	if !ok {
+		return def
+	}
+	return s
+}
+
+// OptFormInt returns the form value name as a number, or def if it is not present
+func (v *Controller) OptFormInt(name string, def int64) int64 {
+	s, ok := v.param(srcForm, name)
+	if !ok {
+		return def
+	}
+	return v.parseInt(srcForm, name, s)
+}
+
+// OptFormBool returns the form value name as a boolean, or def if it is not present
+func (v *Controller) OptFormBool(name string, def bool) bool {
+	s, ok := v.param(srcForm, name)
+	if !ok {
+		return def
+	}
+	return v.parseBool(srcForm, name, s)
+}
+
+// OptFormFloat returns the form value name as a decimal number, or def if it is not present
+func (v *Controller) OptFormFloat(name string, def float64) float64 {
+	s, ok := v.param(srcForm, name)
+	if !ok {
+		return def
+	}
+	return v.parseFloat(srcForm, name, s)
+}
+
+// OptFormDuration returns the form value name as a duration, or def if it is not present
+func (v *Controller) OptFormDuration(name string, def time.Duration) time.Duration {
+	s, ok := v.param(srcForm, name)
+	if !ok {
+		return def
+	}
+	return v.parseDuration(srcForm, name, s)
+}
+
+// OptFormTime returns the form value name as a time, or def if it is not present
+func (v *Controller) OptFormTime(name string, def time.Time) time.Time {
+	s, ok := v.param(srcForm, name)
+	if !ok {
+		return def
+	}
+	return v.parseTime(srcForm, name, s)
+}
+
+// OptFormEnum returns the form value name, which must be one of options, or def if it is not present
+func (v *Controller) OptFormEnum(name string, def string, options ...string) string {
+	s, ok := v.param(srcForm, name)
+	if !ok {
+		return def
+	}
+	return v.parseEnum(srcForm, name, s, options)
+}
+
+// OptFormList returns the form value name split on commas, or def if it is not present
+func (v *Controller) OptFormList(name string, def []string) []string {
+	l := v.list(srcForm, name)
+	if len(l) == 0 {
+		return def
+	}
+	return l
+}
+
+// GetPathVar returns the gorilla/mux route variable name, as in '/users/{name}'
+func (v *Controller) GetPathVar(name string) string {
+	return v.mustParam(srcPath, name)
+}
+
+// GetPathInt returns the route variable name and its value as a number
+func (v *Controller) GetPathInt(name string) (string, int64) {
+	s := v.mustParam(srcPath, name)
+	return s, v.parseInt(srcPath, name, s)
+}
+
+// GetPathUUID returns the route variable name as a dbt.UUID
+func (v *Controller) GetPathUUID(name string) dbt.UUID {
+	return v.parseUUID(srcPath, name, v.mustParam(srcPath, name))
+}
+
+// GetPathEnum returns the route variable name, which must be one of options
+func (v *Controller) GetPathEnum(name string, options ...string) string {
+	return v.parseEnum(srcPath, name, v.mustParam(srcPath, name), options)
+}
@@ -0,0 +1,55 @@
+package htp
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// WantsHTML returns true if the client prefers an HTML page over JSON, such as
+// a browser navigating to a page. Clients that send no Accept header get JSON.
+func WantsHTML(r *http.Request) bool {
+	html, js := 0.0, 0.0
+	for _, item := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(item))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			q, _ = strconv.ParseFloat(s, 64)
+		}
+		switch {
+		case mt == "text/html" || mt == "application/xhtml+xml":
+			if q > html {
+				html = q
+			}
+		case mt == "application/json" || strings.HasSuffix(mt, "+json"):
+			if q > js {
+				js = q
+			}
+		}
+	}
+	return html > 0 && html >= js
+}
+
+// WriteProblem sends err as an RFC 7807 'application/problem+json' document.
+// err.Details are added as extension members.
+func WriteProblem(w http.ResponseWriter, r *http.Request, err *HTTPError) {
+	doc := map[string]interface{}{}
+	for k, v := range err.Details {
+		doc[k] = v
+	}
+	doc["type"] = "about:blank"
+	doc["title"] = http.StatusText(err.Status)
+	doc["status"] = err.Status
+	doc["detail"] = err.Message
+	doc["instance"] = r.URL.Path
+	b, _ := json.Marshal(doc)
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(err.Status)
+	w.Write(b)
+}
@@ -0,0 +1,218 @@
+package htp
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nektro/go-util/util"
+	"github.com/nektro/go.etc/htp/middleware"
+	"github.com/nektro/go.etc/jwt"
+	"github.com/nektro/go.etc/store"
+)
+
+// RateLimitOptions configures RateLimit
+type RateLimitOptions struct {
+	Name   string                       // separates the counters of limits that share a Store
+	Limit  int                          // requests allowed per Window
+	Window time.Duration                // time it takes to regain Limit requests
+	Burst  int                          // requests allowed at once, defaults to Limit
+	Key    func(r *http.Request) string // who the limit applies to, defaults to RateLimitByIP
+	Store  store.Inner                  // where counters are kept if it supports store.Scripter, defaults to store.This
+}
+
+// RateLimit limits requests with a token bucket per Key. Put it on a RouteGroup
+// to limit specific routes, or pass it to Use to limit every request. Rejected
+// requests get a 429 with a Retry-After header. Requests whose Key is empty get
+// a 403. Counters are kept in memory unless Store can run scripts, as the redis
+// store can, in which case they are shared by every instance of the app.
+func RateLimit(opts RateLimitOptions) Middleware {
+	if opts.Limit <= 0 || opts.Window <= 0 {
+		panic("htp: ratelimit: Limit and Window must be positive")
+	}
+	if opts.Burst <= 0 {
+		opts.Burst = opts.Limit
+	}
+	if opts.Key == nil {
+		opts.Key = RateLimitByIP
+	}
+	rl := &rateLimiter{opts: opts, buckets: map[string]bucket{}}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := opts.Key(r)
+			if len(key) == 0 {
+				middleware.Error(w, r, http.StatusForbidden, "unknown client")
+				return
+			}
+			remaining, wait := rl.take(key)
+			h := w.Header()
+			h.Set("X-RateLimit-Limit", strconv.Itoa(opts.Burst))
+			h.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+			h.Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(rl.untilFull(float64(remaining)).Seconds()))))
+			if wait > 0 {
+				h.Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				middleware.Error(w, r, http.StatusTooManyRequests, "too many requests")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RateLimitByIP is a RateLimitOptions.Key that limits each client IP. Clients
+// whose IP is not known, such as local processes on a unix socket that did not
+// come through a proxy, share the one limit of "ip:unix".
+func RateLimitByIP(r *http.Request) string {
+	ip := middleware.ClientIP(r)
+	if ip == nil {
+		return "ip:unix"
+	}
+	return "ip:" + ip.String()
+}
+
+// RateLimitByJWT returns a RateLimitOptions.Key that limits each JWT subject, and
+// each client IP for requests without a valid token or whose token has no subject
+func RateLimitByJWT(secret string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		claims, err := jwt.VerifyRequest(r, secret)
+		if err != nil {
+			return RateLimitByIP(r)
+		}
+		sub, _ := claims["sub"].(string)
+		if len(sub) == 0 {
+			return RateLimitByIP(r)
+		}
+		return "sub:" + sub
+	}
+}
+
+type rateLimiter struct {
+	opts     RateLimitOptions
+	once     sync.Once
+	scripter store.Scripter
+	mtx      sync.Mutex
+	buckets  map[string]bucket
+	swept    time.Time
+}
+
+// bucket is the state of a token bucket kept in memory
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// getScripter returns the store that counters are kept in, or nil to keep them in memory
+func (rl *rateLimiter) getScripter() store.Scripter {
+	rl.once.Do(func() {
+		s := rl.opts.Store
+		if s == nil && store.This != nil {
+			s = store.This
+		}
+		rl.scripter, _ = innerStore(s).(store.Scripter)
+	})
+	return rl.scripter
+}
+
+// innerStore returns the backend of s, where optional interfaces such as store.Scripter are found
+func innerStore(s store.Inner) store.Inner {
+	if st, ok := s.(*store.Store); ok {
+		return st.Inner
+	}
+	return s
+}
+
+// rate returns the time it takes to regain one request
+func (rl *rateLimiter) rate() time.Duration {
+	return rl.opts.Window / time.Duration(rl.opts.Limit)
+}
+
+// untilFull returns the time it takes a bucket with tokens left to refill
+func (rl *rateLimiter) untilFull(tokens float64) time.Duration {
+	return time.Duration((float64(rl.opts.Burst) - tokens) * float64(rl.rate()))
+}
+
+// take uses up one request for key. It returns the number of requests left, and
+// how long the client must wait if there were none.
+func (rl *rateLimiter) take(key string) (int, time.Duration) {
+	var tokens float64
+	var ok bool
+	if s := rl.getScripter(); s != nil {
+		tokens, ok = rl.takeScript(s, key)
+	} else {
+		tokens, ok = rl.takeLocal(key)
+	}
+	if !ok {
+		return 0, time.Duration((1 - tokens) * float64(rl.rate()))
+	}
+	return int(tokens), 0
+}
+
+func (rl *rateLimiter) takeLocal(key string) (float64, bool) {
+	now := time.Now()
+	rl.mtx.Lock()
+	defer rl.mtx.Unlock()
+
+	if now.Sub(rl.swept) > rl.untilFull(0) {
+		// refilled buckets are the same as new ones, so forget them
+		for k, b := range rl.buckets {
+			if now.Sub(b.last) >= rl.untilFull(b.tokens) {
+				delete(rl.buckets, k)
+			}
+		}
+		rl.swept = now
+	}
+	b, found := rl.buckets[key]
+	if !found {
+		b = bucket{float64(rl.opts.Burst), now}
+	}
+	b.tokens = math.Min(float64(rl.opts.Burst), b.tokens+math.Max(0, float64(now.Sub(b.last)))/float64(rl.rate()))
+	b.last = now
+	ok := b.tokens >= 1
+	if ok {
+		b.tokens--
+	}
+	rl.buckets[key] = b
+	return b.tokens, ok
+}
+
+// rateLimitScript refills and takes from the bucket in KEYS[1], then expires it
+// once it would be full again. Times are in milliseconds so that Lua numbers
+// keep them exact.
+const rateLimitScript = `
+local burst = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local v = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(v[1]) or burst
+local last = tonumber(v[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - last) / rate)
+local ok = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	ok = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) * rate) + 1)
+return {ok, tostring(tokens)}
+`
+
+func (rl *rateLimiter) takeScript(s store.Scripter, key string) (float64, bool) {
+	rate := float64(rl.rate()) / float64(time.Millisecond)
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	res, err := s.Eval(rateLimitScript, []string{"htp:ratelimit:" + rl.opts.Name + ":" + key}, rl.opts.Burst, rate, now)
+	arr, _ := res.([]interface{})
+	if err == nil && len(arr) != 2 {
+		err = fmt.Errorf("unexpected reply: %v", res)
+	}
+	if err != nil {
+		// let requests through rather than take the app down with the store
+		util.LogError("htp:", "ratelimit:", err)
+		return float64(rl.opts.Burst), true
+	}
+	ok, _ := arr[0].(int64)
+	tokens, _ := strconv.ParseFloat(fmt.Sprint(arr[1]), 64)
+	return tokens, ok == 1
+}
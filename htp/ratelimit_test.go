@@ -0,0 +1,139 @@
+package htp
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nektro/go.etc/jwt"
+)
+
+func TestRateLimit(t *testing.T) {
+	s, err := New(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := s.Group("/api", RateLimit(RateLimitOptions{Limit: 2, Window: time.Minute}))
+	g.Register("/x", http.MethodGet, func(w http.ResponseWriter, r *http.Request) {})
+	h := s.Handler()
+	cases := []struct {
+		remote     string
+		status     int
+		remaining  string
+		retryAfter string
+	}{
+		{"203.0.113.1:1234", http.StatusOK, "1", ""},
+		{"203.0.113.1:1234", http.StatusOK, "0", ""},
+		{"203.0.113.1:1234", http.StatusTooManyRequests, "0", "30"},
+		{"203.0.113.2:1234", http.StatusOK, "1", ""},
+		// clients without an IP share one bucket instead of being rejected
+		{"@", http.StatusOK, "1", ""},
+		{"@", http.StatusOK, "0", ""},
+		{"", http.StatusTooManyRequests, "0", "30"},
+	}
+	for i, tc := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/api/x", nil)
+		r.RemoteAddr = tc.remote
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != tc.status || rec.Header().Get("X-RateLimit-Remaining") != tc.remaining || rec.Header().Get("Retry-After") != tc.retryAfter {
+			t.Errorf("%d: got %d remaining=%q retry-after=%q, want %d %q %q", i, rec.Code, rec.Header().Get("X-RateLimit-Remaining"), rec.Header().Get("Retry-After"), tc.status, tc.remaining, tc.retryAfter)
+		}
+	}
+}
+
+func TestRateLimitByJWT(t *testing.T) {
+	key := RateLimitByJWT("secret")
+	cases := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{"subject", jwt.Get("app", "alice", "secret", time.Now(), time.Hour), "sub:alice"},
+		{"empty subject", jwt.Get("app", "", "secret", time.Now(), time.Hour), "ip:203.0.113.1"},
+		{"wrong secret", jwt.Get("app", "alice", "other", time.Now(), time.Hour), "ip:203.0.113.1"},
+		{"no token", "", "ip:203.0.113.1"},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "203.0.113.1:1234"
+		if len(tc.token) > 0 {
+			r.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		if got := key(r); got != tc.want {
+			t.Errorf("%s: key = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRateLimiterLocal(t *testing.T) {
+	rl := &rateLimiter{opts: RateLimitOptions{Limit: 2, Window: time.Second, Burst: 2}, buckets: map[string]bucket{}}
+	if n, wait := rl.take("a"); n != 1 || wait != 0 {
+		t.Fatalf("take = %d %s, want 1 0s", n, wait)
+	}
+	rl.take("a")
+	if n, wait := rl.take("a"); n != 0 || wait <= 0 || wait > 500*time.Millisecond {
+		t.Fatalf("take on an empty bucket = %d %s, want 0 and up to 500ms", n, wait)
+	}
+
+	// a bucket regains Limit tokens per Window
+	rl.buckets["a"] = bucket{0, time.Now().Add(-500 * time.Millisecond)}
+	if n, wait := rl.take("a"); n != 0 || wait != 0 {
+		t.Fatalf("take after a refill = %d %s, want 0 0s", n, wait)
+	}
+
+	// full buckets are forgotten on the next sweep
+	rl.buckets["b"] = bucket{2, time.Now().Add(-time.Minute)}
+	rl.swept = time.Now().Add(-time.Minute)
+	rl.take("c")
+	if _, ok := rl.buckets["b"]; ok {
+		t.Errorf("full bucket was kept: %v", rl.buckets)
+	}
+	if _, ok := rl.buckets["a"]; !ok {
+		t.Errorf("bucket in use was dropped: %v", rl.buckets)
+	}
+}
+
+type fakeScripter struct {
+	keys  []string
+	args  []interface{}
+	reply interface{}
+	err   error
+}
+
+func (f *fakeScripter) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	f.keys, f.args = keys, args
+	return f.reply, f.err
+}
+
+func TestRateLimiterScript(t *testing.T) {
+	cases := []struct {
+		name  string
+		reply interface{}
+		err   error
+		n     int
+		wait  time.Duration
+	}{
+		{"allowed", []interface{}{int64(1), "1.5"}, nil, 1, 0},
+		{"limited", []interface{}{int64(0), "0.25"}, nil, 0, 375 * time.Millisecond},
+		{"store error lets requests through", nil, errors.New("down"), 2, 0},
+		{"bad reply lets requests through", []interface{}{int64(1)}, nil, 2, 0},
+	}
+	for _, tc := range cases {
+		fs := &fakeScripter{reply: tc.reply, err: tc.err}
+		rl := &rateLimiter{opts: RateLimitOptions{Name: "api", Limit: 2, Window: time.Second, Burst: 2}, scripter: fs}
+		rl.once.Do(func() {})
+		n, wait := rl.take("ip:203.0.113.1")
+		if n != tc.n || wait != tc.wait {
+			t.Errorf("%s: take = %d %s, want %d %s", tc.name, n, wait, tc.n, tc.wait)
+		}
+		if len(fs.keys) != 1 || fs.keys[0] != "htp:ratelimit:api:ip:203.0.113.1" {
+			t.Errorf("%s: keys = %v", tc.name, fs.keys)
+		}
+		if len(fs.args) != 3 || fs.args[0] != 2 || fs.args[1] != 500.0 {
+			t.Errorf("%s: args = %v, want burst 2 and 500ms per request", tc.name, fs.args)
+		}
+	}
+}
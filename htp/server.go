@@ -0,0 +1,271 @@
+package htp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/nektro/go-util/util"
+	"github.com/nektro/go.etc/htp/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Options configures a Server
+type Options struct {
+	Base            string        // path to mount all routes on, must end in '/'
+	ShutdownTimeout time.Duration // how long Serve waits for in-flight requests when stopping
+	SocketMode      os.FileMode   // permissions of unix sockets made by Listen
+	TLS             TLSOptions
+	Static          StaticOptions    // used by RegisterFileSystem
+	SecurityHeaders *SecurityHeaders // defaults to DefaultSecurityHeaders
+	Health          bool             // serve /healthz, /readyz, and /version
+	Metrics         bool             // record Prometheus metrics and serve them at /metrics
+	OpenAPI         bool             // serve an OpenAPI document of the registered routes at /openapi.json
+	OpenAPIUI       bool             // serve a page that displays the OpenAPI document at /docs
+	MetricsBind     string           // serve /metrics on this address instead of with the other routes
+
+	// limits of the http.Server made by Serve, zero means no limit
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int   // zero uses http.DefaultMaxHeaderBytes
+	MaxBodyBytes      int64 // largest request body accepted by registered routes, see MaxBodyBytes and BodyLimit
+}
+
+// Server is a router along with the http.Server that serves it. Most apps use the
+// default instance through the package level functions, which is set up by Init.
+type Server struct {
+	// ErrorHandleFunc sends errors to the client. The package level ErrorHandleFunc is used if nil.
+	ErrorHandleFunc func(http.ResponseWriter, *http.Request, *HTTPError)
+
+	opts          Options
+	router        *mux.Router
+	baseReal      string
+	middlewares   []Middleware
+	srv           *http.Server
+	redirectSrv   *http.Server
+	metricsSrv    *http.Server
+	shutdownHooks []func() error
+	shutdownOnce  sync.Once
+	shutdownDone  chan struct{}
+	shutdownErr   error
+	baseCtx       context.Context
+	cancelBase    context.CancelFunc
+	stopping      chan struct{}
+	streams       sync.WaitGroup
+	conns         map[*websocket.Conn]bool
+	connsMtx      sync.Mutex
+	checks        []readyCheck
+	checksMtx     sync.Mutex
+	routes        []*routeInfo
+	routesMtx     sync.Mutex
+}
+
+// New returns a Server with no routes
+func New(opts Options) (*Server, error) {
+	if len(opts.Base) == 0 {
+		opts.Base = "/"
+	}
+	if !strings.HasSuffix(opts.Base, "/") {
+		return nil, errors.New("htp: base must end in '/'")
+	}
+	if opts.SocketMode == 0 {
+		opts.SocketMode = 0660
+	}
+	if opts.SecurityHeaders == nil {
+		h := DefaultSecurityHeaders()
+		opts.SecurityHeaders = &h
+	}
+	s := &Server{
+		opts:         opts,
+		router:       mux.NewRouter(),
+		baseReal:     strings.TrimSuffix(opts.Base, "/"),
+		shutdownDone: make(chan struct{}),
+		stopping:     make(chan struct{}),
+		conns:        map[*websocket.Conn]bool{},
+	}
+	s.baseCtx, s.cancelBase = context.WithCancel(context.Background())
+	s.router.NotFoundHandler = s.instrument("unmatched", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.HandleError(w, r, NewError(http.StatusNotFound, "not found"))
+	}))
+	s.router.MethodNotAllowedHandler = s.instrument("unmatched", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.HandleError(w, r, NewError(http.StatusMethodNotAllowed, "method not allowed"))
+	}))
+	s.middlewares = []Middleware{s.withServer}
+	s.Use(opts.SecurityHeaders.middleware)
+	if opts.Health {
+		s.registerHealth()
+	}
+	if opts.Metrics {
+		registerMetrics()
+		if len(opts.MetricsBind) == 0 {
+			s.register("/metrics", http.MethodGet, promhttp.Handler(), nil, []RouteOption{Hidden()})
+		}
+	}
+	if opts.OpenAPI || opts.OpenAPIUI {
+		s.registerOpenAPI(opts.OpenAPIUI)
+	}
+	return s, nil
+}
+
+// serverOf returns the Server handling r, or the default instance
+func serverOf(r *http.Request) *Server {
+	s, ok := r.Context().Value(ctxKeyServer).(*Server)
+	if !ok {
+		return defaultServer
+	}
+	return s
+}
+
+// withServer stores s in the request context and sends errors from the middleware package through it
+func (s *Server) withServer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(context.WithValue(r.Context(), ctxKeyServer, s))
+		next.ServeHTTP(w, middleware.WithErrorFunc(r, func(w http.ResponseWriter, r *http.Request, status int, message string) {
+			s.HandleError(w, r, NewError(status, message))
+		}))
+	})
+}
+
+// Handler returns the http.Handler that serves this Server's routes and middleware
+func (s *Server) Handler() http.Handler {
+	return chain(s.router, s.middlewares)
+}
+
+// Router returns the gorilla/mux router this Server registers routes on
+func (s *Server) Router() *mux.Router {
+	return s.router
+}
+
+// Base returns the root that all methods are mounted on
+func (s *Server) Base() string {
+	return s.baseReal + "/"
+}
+
+// Register adds a handler to this router.
+func (s *Server) Register(path, method string, h func(w http.ResponseWriter, r *http.Request), opts ...RouteOption) {
+	s.register(path, method, http.HandlerFunc(h), nil, opts)
+}
+
+// RegisterE adds a handler that reports failure by returning an error
+func (s *Server) RegisterE(path, method string, h HandlerFunc, opts ...RouteOption) {
+	s.register(path, method, h, nil, opts)
+}
+
+func (s *Server) register(path, method string, h http.Handler, mws []Middleware, opts []RouteOption) {
+	methods := []string{}
+	if len(method) > 0 {
+		methods = append(methods, method)
+	}
+	if method == http.MethodGet {
+		methods = append(methods, http.MethodHead)
+	}
+	rt := s.router.NewRoute()
+	rt.Methods(methods...)
+	if strings.HasSuffix(path, "/*") {
+		rt.PathPrefix(s.baseReal + strings.TrimSuffix(path, "*"))
+	} else {
+		rt.Path(s.baseReal + path)
+	}
+	route, _ := rt.GetPathTemplate()
+	ri := newRouteInfo(method, path, opts)
+	s.routesMtx.Lock()
+	s.routes = append(s.routes, ri)
+	s.routesMtx.Unlock()
+	rt.Handler(s.instrument(route, s.trace(route, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = withController(r, ri)
+		atomic.AddInt64(&activeControllers, 1)
+		defer atomic.AddInt64(&activeControllers, -1)
+		defer func() {
+			if rcv := recover(); rcv != nil {
+				if err, ok := rcv.(error); ok {
+					var he *HTTPError
+					if errors.As(err, &he) {
+						s.HandleError(w, r, he)
+						return
+					}
+				}
+				panic(rcv)
+			}
+		}()
+		chain(s.limitBody(csrfCheck(h, ri), ri), mws).ServeHTTP(w, r)
+	}))))
+}
+
+// RegisterFileSystem is a custom version of Register where it adds a http.FileSystem to the router
+func (s *Server) RegisterFileSystem(fs http.FileSystem) {
+	s.RegisterStatic("/", fs, s.opts.Static)
+}
+
+// RegisterStatic serves the files in fs under prefix with opts. See Static.
+func (s *Server) RegisterStatic(prefix string, fs http.FileSystem, opts StaticOptions) {
+	p := s.baseReal + cleanPrefix(prefix) + "/"
+	rt := s.router.PathPrefix(p)
+	route, _ := rt.GetPathTemplate()
+	rt.Handler(s.instrument(route, s.trace(route, http.StripPrefix(strings.TrimSuffix(p, "/"), s.Static(fs, opts)))))
+}
+
+// StartServer listens on the socket returned by Listen until it is stopped. See Serve.
+func (s *Server) StartServer(bind string, port int) error {
+	l, err := s.Listen(bind, port)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve handles requests on l until it is stopped by Stop, SIGINT, or SIGTERM.
+// In-flight requests are given Options.ShutdownTimeout to finish and then the
+// OnShutdown hooks are run.
+func (s *Server) Serve(l net.Listener) error {
+	s.srv = s.httpServer(s.Handler())
+	serve := func() error { return s.srv.Serve(l) }
+	if s.opts.TLS.Enabled() {
+		host, port := "", 443
+		if a, ok := l.Addr().(*net.TCPAddr); ok {
+			host, port = a.IP.String(), a.Port
+		}
+		cfg, redirect, err := s.opts.TLS.Config(port)
+		if err != nil {
+			l.Close()
+			return err
+		}
+		s.srv.TLSConfig = cfg
+		serve = func() error { return s.srv.ServeTLS(l, "", "") }
+		if s.opts.TLS.RedirectPort > 0 {
+			rp := strconv.Itoa(s.opts.TLS.RedirectPort)
+			util.Log("Redirecting HTTP to HTTPS from port " + rp)
+			s.redirectSrv = s.httpServer(redirect)
+			s.redirectSrv.Addr = net.JoinHostPort(host, rp)
+			go func() {
+				if err := s.redirectSrv.ListenAndServe(); err != http.ErrServerClosed {
+					util.LogError("htp:", "redirect server:", err)
+				}
+			}()
+		}
+	}
+	if s.opts.Metrics && len(s.opts.MetricsBind) > 0 {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		s.metricsSrv = s.httpServer(mux)
+		s.metricsSrv.Addr = s.opts.MetricsBind
+		util.Log("Serving metrics on " + s.opts.MetricsBind)
+		go func() {
+			if err := s.metricsSrv.ListenAndServe(); err != http.ErrServerClosed {
+				util.LogError("htp:", "metrics server:", err)
+			}
+		}()
+	}
+	util.Log("Initialization complete.")
+	return s.waitForShutdown(serve)
+}
@@ -0,0 +1,99 @@
+package htp
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestServer returns a Server mounted on /app/ with a few routes
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	s, err := New(Options{Base: "/app/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Register("/hello", http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	})
+	s.RegisterE("/items/{id}", http.MethodGet, func(c *Controller, w http.ResponseWriter, r *http.Request) error {
+		_, id := c.GetPathInt("id")
+		if id == 0 {
+			return NewError(http.StatusNotFound, "no such item")
+		}
+		if id < 0 {
+			return errors.New("internal")
+		}
+		io.WriteString(w, "item "+c.GetPathVar("id"))
+		return nil
+	})
+	s.RegisterE("/search", http.MethodGet, func(c *Controller, w http.ResponseWriter, r *http.Request) error {
+		io.WriteString(w, c.GetQueryString("q"))
+		return nil
+	})
+	g := s.Group("/admin", func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			GetController(r).AssertStatus(r.Header.Get("X-Admin") == "1", http.StatusForbidden, "admins only")
+			next.ServeHTTP(w, r)
+		})
+	})
+	g.Register("/", http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "admin")
+	})
+	return s
+}
+
+func TestServerRouting(t *testing.T) {
+	h := newTestServer(t).Handler()
+	cases := []struct {
+		method, path string
+		header       string
+		status       int
+		body         string
+	}{
+		{http.MethodGet, "/app/hello", "", http.StatusOK, "hello"},
+		{http.MethodHead, "/app/hello", "", http.StatusOK, ""},
+		{http.MethodPost, "/app/hello", "", http.StatusMethodNotAllowed, ""},
+		{http.MethodGet, "/hello", "", http.StatusNotFound, ""},
+		{http.MethodGet, "/app/items/7", "", http.StatusOK, "item 7"},
+		{http.MethodGet, "/app/items/0", "", http.StatusNotFound, ""},
+		{http.MethodGet, "/app/items/-1", "", http.StatusInternalServerError, ""},
+		{http.MethodGet, "/app/items/x", "", http.StatusBadRequest, ""},
+		{http.MethodGet, "/app/search?q=go", "", http.StatusOK, "go"},
+		{http.MethodGet, "/app/search", "", http.StatusBadRequest, ""},
+		{http.MethodGet, "/app/admin/", "", http.StatusForbidden, ""},
+		{http.MethodGet, "/app/admin/", "1", http.StatusOK, "admin"},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest(tc.method, tc.path, nil)
+		if len(tc.header) > 0 {
+			r.Header.Set("X-Admin", tc.header)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != tc.status {
+			t.Errorf("%s %s: status = %d, want %d", tc.method, tc.path, rec.Code, tc.status)
+		}
+		if len(tc.body) > 0 && strings.TrimSpace(rec.Body.String()) != tc.body {
+			t.Errorf("%s %s: body = %q, want %q", tc.method, tc.path, rec.Body.String(), tc.body)
+		}
+	}
+}
+
+func TestServerErrorHandleFunc(t *testing.T) {
+	s := newTestServer(t)
+	s.ErrorHandleFunc = func(w http.ResponseWriter, r *http.Request, err *HTTPError) {
+		WriteProblem(w, r, err)
+	}
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/app/items/0", nil))
+	if rec.Code != http.StatusNotFound || rec.Header().Get("Content-Type") != "application/problem+json" {
+		t.Fatalf("got %d %q, want a 404 problem document", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), `"detail":"no such item"`) {
+		t.Errorf("body = %s, want the error message as detail", rec.Body.String())
+	}
+}
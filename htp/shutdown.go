@@ -0,0 +1,158 @@
+package htp
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nektro/go-util/util"
+	"github.com/nektro/go-util/vflag"
+)
+
+var (
+	flagShutdownTimeout string
+)
+
+func shutdownPreInit() {
+	vflag.StringVar(&flagShutdownTimeout, "shutdown-timeout", "30s", "How long to wait for in-flight requests to finish when stopping.")
+}
+
+// OnShutdown adds f to the list of functions run, in the order they were added,
+// after the default server has stopped accepting requests and drained in-flight ones
+func OnShutdown(f func() error) {
+	defaultServer.OnShutdown(f)
+}
+
+// OnShutdown adds f to the list of functions run, in the order they were added,
+// after this server has stopped accepting requests and drained in-flight ones
+func (s *Server) OnShutdown(f func() error) {
+	s.shutdownHooks = append(s.shutdownHooks, f)
+}
+
+// waitForShutdown runs serve until it fails or the process is told to stop
+func (s *Server) waitForShutdown(serve func() error) error {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- serve()
+	}()
+	select {
+	case err := <-errc:
+		if err != http.ErrServerClosed {
+			return err
+		}
+		// Stop was called, wait for it to finish
+		<-s.shutdownDone
+		return s.shutdownErr
+	case sg := <-sig:
+		util.Log("htp:", "received", sg.String()+",", "shutting down")
+		go func() {
+			// a second signal skips the drain
+			sg := <-sig
+			util.Log("htp:", "received", sg.String(), "again,", "exiting now")
+			os.Exit(1)
+		}()
+		return s.Stop()
+	}
+}
+
+// Stop performs a graceful shutdown of this server and runs its OnShutdown hooks.
+// WebSocket and SSE streams are ended first, as they would not finish on their
+// own. Requests still running when the drain times out have their context
+// cancelled before the hooks are run. It is safe to call more than once.
+func (s *Server) Stop() error {
+	s.shutdownOnce.Do(func() {
+		ctx := context.Background()
+		if s.opts.ShutdownTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, s.opts.ShutdownTimeout)
+			defer cancel()
+		}
+		close(s.stopping)
+		s.closeConns()
+		if s.srv != nil {
+			s.shutdownErr = s.srv.Shutdown(ctx)
+		}
+		s.waitStreams(ctx)
+		s.cancelBase()
+		if s.redirectSrv != nil {
+			s.redirectSrv.Shutdown(ctx)
+		}
+		if s.metricsSrv != nil {
+			s.metricsSrv.Shutdown(ctx)
+		}
+		for _, item := range s.shutdownHooks {
+			if err := item(); err != nil {
+				util.LogError("htp:", "shutdown:", err)
+			}
+		}
+		close(s.shutdownDone)
+	})
+	<-s.shutdownDone
+	return s.shutdownErr
+}
+
+// streamContext returns a copy of parent that is also cancelled when Stop is called
+func (s *Server) streamContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	go func() {
+		select {
+		case <-s.stopping:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// trackConn keeps conn so that Stop can close it, as hijacked connections are not
+// seen by http.Server.Shutdown. It returns false if the server is already stopping.
+func (s *Server) trackConn(conn *websocket.Conn) bool {
+	s.connsMtx.Lock()
+	defer s.connsMtx.Unlock()
+	select {
+	case <-s.stopping:
+		return false
+	default:
+	}
+	s.conns[conn] = true
+	s.streams.Add(1)
+	return true
+}
+
+func (s *Server) untrackConn(conn *websocket.Conn) {
+	s.connsMtx.Lock()
+	defer s.connsMtx.Unlock()
+	delete(s.conns, conn)
+	s.streams.Done()
+}
+
+// closeConns tells every WebSocket client that the server is going away and closes its connection
+func (s *Server) closeConns() {
+	s.connsMtx.Lock()
+	defer s.connsMtx.Unlock()
+	for conn := range s.conns {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server is shutting down"), time.Now().Add(time.Second))
+		conn.Close()
+	}
+}
+
+// waitStreams waits for WebSocket handlers to return, or for ctx to be done
+func (s *Server) waitStreams(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		s.streams.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
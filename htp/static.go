@@ -0,0 +1,208 @@
+package htp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nektro/go-util/vflag"
+	"github.com/nektro/go.etc/htp/middleware"
+)
+
+// StaticOptions configures the handler made by Server.Static
+type StaticOptions struct {
+	DirectoryListing bool        // list the contents of directories that have no index.html
+	CacheControl     []CacheRule // the first rule to match a path sets its Cache-Control header
+	Precompressed    bool        // serve 'file.br' or 'file.gz' in place of 'file' when the client accepts it
+	SPAFallback      bool        // serve /index.html for missing paths that have no file extension
+}
+
+// CacheRule sets the Cache-Control header to Value for paths matching Pattern.
+// Patterns use path.Match syntax and are matched against the file name if they
+// contain no '/', else against the full path.
+type CacheRule struct {
+	Pattern string
+	Value   string
+}
+
+var (
+	flagStaticListing       bool
+	flagStaticCache         []string
+	flagStaticPrecompressed bool
+	flagStaticSPA           bool
+)
+
+func staticPreInit() {
+	vflag.BoolVar(&flagStaticListing, "static-dir-listing", true, "List the contents of static directories that have no index.html.")
+	vflag.StringArrayVar(&flagStaticCache, "static-cache", []string{}, "Cache-Control for static files matching a pattern, such as '*.js=public, max-age=86400'.")
+	vflag.BoolVar(&flagStaticPrecompressed, "static-precompressed", true, "Serve .br and .gz siblings of static files to clients that accept them.")
+	vflag.BoolVar(&flagStaticSPA, "static-spa", false, "Serve /index.html for missing static paths that have no file extension.")
+}
+
+func staticOptions() StaticOptions {
+	rules := []CacheRule{}
+	for _, item := range flagStaticCache {
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) == 2 {
+			rules = append(rules, CacheRule{strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])})
+		}
+	}
+	return StaticOptions{
+		DirectoryListing: flagStaticListing,
+		CacheControl:     rules,
+		Precompressed:    flagStaticPrecompressed,
+		SPAFallback:      flagStaticSPA,
+	}
+}
+
+// Static returns a handler that serves the files in fs. Missing files are sent
+// through HandleError as a 404.
+func (s *Server) Static(fs http.FileSystem, opts StaticOptions) http.Handler {
+	return &staticHandler{s, fs, opts, http.FileServer(fs), map[string]etagEntry{}, new(sync.Mutex)}
+}
+
+type staticHandler struct {
+	s       *Server
+	fs      http.FileSystem
+	opts    StaticOptions
+	listing http.Handler
+	etags   map[string]etagEntry
+	mtx     *sync.Mutex
+}
+
+type etagEntry struct {
+	modTime time.Time
+	size    int64
+	etag    string
+}
+
+func (h *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		h.s.HandleError(w, r, NewError(http.StatusMethodNotAllowed, "method not allowed"))
+		return
+	}
+	name := path.Clean("/" + r.URL.Path)
+	f, stat, err := h.open(name)
+	if err != nil && h.opts.SPAFallback && path.Ext(name) == "" {
+		name = "/index.html"
+		f, stat, err = h.open(name)
+	}
+	if err != nil {
+		h.s.HandleError(w, r, NewError(http.StatusNotFound, "not found"))
+		return
+	}
+	defer f.Close()
+
+	if stat.IsDir() {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			// relative so that it works behind http.StripPrefix
+			loc := "./" + path.Base(r.URL.Path) + "/"
+			if len(r.URL.RawQuery) > 0 {
+				loc += "?" + r.URL.RawQuery
+			}
+			w.Header().Set("Location", loc)
+			w.WriteHeader(http.StatusMovedPermanently)
+			return
+		}
+		index := strings.TrimSuffix(name, "/") + "/index.html"
+		fi, istat, err := h.open(index)
+		if err != nil || istat.IsDir() {
+			if h.opts.DirectoryListing {
+				h.listing.ServeHTTP(w, r)
+				return
+			}
+			h.s.HandleError(w, r, NewError(http.StatusNotFound, "not found"))
+			return
+		}
+		defer fi.Close()
+		name, f, stat = index, fi, istat
+	}
+
+	if cc := h.cacheControl(name); len(cc) > 0 {
+		w.Header().Set("Cache-Control", cc)
+	}
+	if h.opts.Precompressed {
+		w.Header().Add("Vary", "Accept-Encoding")
+		for _, enc := range middleware.AcceptedEncodings(r) {
+			cf, cstat, err := h.open(name + encodingExts[enc])
+			if err != nil || cstat.IsDir() {
+				continue
+			}
+			defer cf.Close()
+			w.Header().Set("Content-Encoding", enc)
+			h.serve(w, r, name, name+encodingExts[enc], cf, cstat)
+			return
+		}
+	}
+	h.serve(w, r, name, name, f, stat)
+}
+
+// serve sends f as the content of name. key is the path f was opened with.
+func (h *staticHandler) serve(w http.ResponseWriter, r *http.Request, name, key string, f http.File, stat os.FileInfo) {
+	etag, err := h.etag(key, f, stat)
+	if err == nil {
+		w.Header().Set("ETag", etag)
+	}
+	http.ServeContent(w, r, name, stat.ModTime(), f)
+}
+
+func (h *staticHandler) open(name string) (http.File, os.FileInfo, error) {
+	f, err := h.fs.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, stat, nil
+}
+
+// etag returns a strong ETag from the hash of f, which is cached until the file changes
+func (h *staticHandler) etag(key string, f http.File, stat os.FileInfo) (string, error) {
+	h.mtx.Lock()
+	e, ok := h.etags[key]
+	h.mtx.Unlock()
+	if ok && e.modTime.Equal(stat.ModTime()) && e.size == stat.Size() {
+		return e.etag, nil
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag := `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+	h.mtx.Lock()
+	h.etags[key] = etagEntry{stat.ModTime(), stat.Size(), etag}
+	h.mtx.Unlock()
+	return etag, nil
+}
+
+func (h *staticHandler) cacheControl(name string) string {
+	for _, item := range h.opts.CacheControl {
+		target := name
+		if !strings.Contains(item.Pattern, "/") {
+			target = path.Base(name)
+		}
+		if ok, _ := path.Match(item.Pattern, target); ok {
+			return item.Value
+		}
+	}
+	return ""
+}
+
+// encodingExts maps a Content-Encoding to the extension of its precompressed file
+var encodingExts = map[string]string{
+	"br":   ".br",
+	"gzip": ".gz",
+}
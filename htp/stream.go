@@ -0,0 +1,204 @@
+package htp
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nektro/go-util/util"
+)
+
+// Upgrader is used by RegisterWS. By default it only accepts connections from
+// pages on the same origin.
+var Upgrader = websocket.Upgrader{}
+
+// WSHandlerFunc handles a WebSocket connection. Returned errors and failed
+// Controller assertions close the connection with the error's public message.
+// When the server stops, r.Context() is cancelled and the connection is closed.
+type WSHandlerFunc func(c *Controller, conn *websocket.Conn, r *http.Request) error
+
+// SSEHandlerFunc streams Server-Sent Events until it returns or the client goes
+// away or the server stops, which cancels r.Context(). Errors before the first
+// event are sent through HandleError as usual, later ones are sent as an 'error' event.
+type SSEHandlerFunc func(c *Controller, s *SSEStream, r *http.Request) error
+
+// RegisterWS adds a WebSocket endpoint to the default server
+func RegisterWS(path string, h WSHandlerFunc, opts ...RouteOption) {
+	defaultServer.RegisterWS(path, h, opts...)
+}
+
+// RegisterSSE adds a Server-Sent Events endpoint to the default server
+func RegisterSSE(path string, h SSEHandlerFunc, opts ...RouteOption) {
+	defaultServer.RegisterSSE(path, h, opts...)
+}
+
+// RegisterWS adds a WebSocket endpoint. Requests pass through the same
+// middleware as Register, so they may be rejected before the upgrade.
+func (s *Server) RegisterWS(path string, h WSHandlerFunc, opts ...RouteOption) {
+	s.register(path, http.MethodGet, h, nil, opts)
+}
+
+// RegisterSSE adds a Server-Sent Events endpoint
+func (s *Server) RegisterSSE(path string, h SSEHandlerFunc, opts ...RouteOption) {
+	s.register(path, http.MethodGet, h, nil, opts)
+}
+
+// RegisterWS adds a WebSocket endpoint to this group
+func (g *RouteGroup) RegisterWS(path string, h WSHandlerFunc, opts ...RouteOption) {
+	g.s.register(g.prefix+path, http.MethodGet, h, g.mws, opts)
+}
+
+// RegisterSSE adds a Server-Sent Events endpoint to this group
+func (g *RouteGroup) RegisterSSE(path string, h SSEHandlerFunc, opts ...RouteOption) {
+	g.s.register(g.prefix+path, http.MethodGet, h, g.mws, opts)
+}
+
+// ServeHTTP implements the http.Handler interface
+func (h WSHandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u := Upgrader
+	if u.Error == nil {
+		u.Error = func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+			HandleError(w, r, NewError(status, reason.Error()))
+		}
+	}
+	conn, err := u.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	if srv := serverOf(r); srv != nil {
+		if !srv.trackConn(conn) {
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server is shutting down"), time.Now().Add(time.Second))
+			return
+		}
+		defer srv.untrackConn(conn)
+		ctx, cancel := srv.streamContext(r.Context())
+		defer cancel()
+		r = withContext(r, ctx)
+	}
+
+	c := GetController(r)
+	he := AsHTTPError(catch(func() error { return h(c, conn, r) }))
+	code, msg := websocket.CloseNormalClosure, ""
+	if he != nil {
+		var ce *websocket.CloseError
+		if errors.As(he, &ce) {
+			// the client hung up
+			return
+		}
+		if he.Err != nil {
+			util.LogError("htp:", "ws:", r.URL.Path, he.Err)
+		}
+		code, msg = websocket.CloseInternalServerErr, he.Message
+		if he.Status < 500 {
+			code = websocket.ClosePolicyViolation
+		}
+	}
+	if len(msg) > 123 {
+		// the limit of a control frame
+		msg = msg[:123]
+	}
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, msg), time.Now().Add(time.Second))
+}
+
+// ServeHTTP implements the http.Handler interface
+func (h SSEHandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if srv := serverOf(r); srv != nil {
+		ctx, cancel := srv.streamContext(r.Context())
+		defer cancel()
+		r = withContext(r, ctx)
+	}
+	s := &SSEStream{w: w, rc: http.NewResponseController(w)}
+	he := AsHTTPError(catch(func() error { return h(GetController(r), s, r) }))
+	if he == nil {
+		return
+	}
+	if !s.started {
+		HandleError(w, r, he)
+		return
+	}
+	if he.Err != nil {
+		util.LogError("htp:", "sse:", r.URL.Path, he.Err)
+	}
+	s.Send("error", he.Message)
+}
+
+// catch runs f and returns the HTTPError it panics with, such as from a failed
+// Controller assertion. Other panics are passed on.
+func catch(f func() error) (err error) {
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			if e, ok := rcv.(error); ok {
+				var he *HTTPError
+				if errors.As(e, &he) {
+					err = he
+					return
+				}
+			}
+			panic(rcv)
+		}
+	}()
+	return f()
+}
+
+// SSEStream writes Server-Sent Events to a client
+type SSEStream struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	started bool
+}
+
+func (s *SSEStream) start() {
+	if s.started {
+		return
+	}
+	s.started = true
+	h := s.w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	// streams outlive --write-timeout
+	s.rc.SetWriteDeadline(time.Time{})
+	s.w.WriteHeader(http.StatusOK)
+}
+
+func (s *SSEStream) write(str string) error {
+	s.start()
+	if _, err := io.WriteString(s.w, str); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// Send writes an event with data, which may span several lines. An empty event
+// is received as 'message' by the client.
+func (s *SSEStream) Send(event, data string) error {
+	b := new(strings.Builder)
+	if len(event) > 0 {
+		b.WriteString("event: " + event + "\n")
+	}
+	for _, item := range strings.Split(data, "\n") {
+		b.WriteString("data: " + item + "\n")
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// SendJSON writes an event with v encoded as json
+func (s *SSEStream) SendJSON(event string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.Send(event, string(b))
+}
+
+// Comment writes a line that clients ignore, such as to keep idle connections
+// from being closed by proxies
+func (s *SSEStream) Comment(text string) error {
+	return s.write(": " + strings.ReplaceAll(text, "\n", " ") + "\n\n")
+}
@@ -0,0 +1,181 @@
+package htp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nektro/go-util/vflag"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLSOptions configures HTTPS for StartServer. Either CertFile and KeyFile, or
+// ACMEDomains must be set to enable it.
+type TLSOptions struct {
+	CertFile      string   // PEM certificate chain, reloaded when the file changes
+	KeyFile       string   // PEM private key, reloaded when the file changes
+	RedirectPort  int      // if not 0, also listen on this port and redirect plain http to https
+	ACMEDomains   []string // request certificates for these domains automatically, using tls-alpn-01 or http-01 on RedirectPort
+	ACMEEmail     string   // contact address sent to the ACME server
+	ACMEDirectory string   // ACME directory URL, Let's Encrypt if empty
+	ACMECache     string   // directory to store certificates in between restarts
+	ACMERootCA    string   // PEM file trusted when talking to ACMEDirectory, such as pebble's test CA
+}
+
+// TLS holds the options set by flags
+var TLS TLSOptions
+
+func tlsPreInit() {
+	vflag.StringVar(&TLS.CertFile, "tls-cert", "", "Path to a PEM certificate to serve HTTPS with.")
+	vflag.StringVar(&TLS.KeyFile, "tls-key", "", "Path to the PEM private key of --tls-cert.")
+	vflag.IntVar(&TLS.RedirectPort, "tls-redirect-port", 0, "Port to redirect plain HTTP requests to HTTPS from. 0 to disable.")
+	vflag.StringArrayVar(&TLS.ACMEDomains, "acme-domain", []string{}, "Domain to automatically obtain a certificate for with ACME.")
+	vflag.StringVar(&TLS.ACMEEmail, "acme-email", "", "Contact email to register with the ACME server.")
+	vflag.StringVar(&TLS.ACMEDirectory, "acme-directory", "", "ACME directory URL. Defaults to Let's Encrypt.")
+	vflag.StringVar(&TLS.ACMECache, "acme-cache", "", "Directory to cache ACME certificates in.")
+	vflag.StringVar(&TLS.ACMERootCA, "acme-root-ca", "", "PEM file of a CA to trust when connecting to --acme-directory.")
+}
+
+// Enabled returns true if these options will serve HTTPS
+func (o TLSOptions) Enabled() bool {
+	return len(o.ACMEDomains) > 0 || (len(o.CertFile) > 0 && len(o.KeyFile) > 0)
+}
+
+// Config returns the tls.Config to serve with, and a handler for the plain http
+// port that answers ACME challenges and redirects everything else to https.
+func (o TLSOptions) Config(httpsPort int) (*tls.Config, http.Handler, error) {
+	redirect := redirectHTTPS(httpsPort)
+	if len(o.ACMEDomains) > 0 {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(o.ACMEDomains...),
+			Email:      o.ACMEEmail,
+		}
+		if len(o.ACMECache) > 0 {
+			m.Cache = autocert.DirCache(o.ACMECache)
+		}
+		if len(o.ACMEDirectory) > 0 {
+			client, err := acmeHTTPClient(o.ACMERootCA)
+			if err != nil {
+				return nil, nil, err
+			}
+			m.Client = &acme.Client{DirectoryURL: o.ACMEDirectory, HTTPClient: client}
+		}
+		cfg := m.TLSConfig()
+		cfg.MinVersion = tls.VersionTLS12
+		return cfg, m.HTTPHandler(redirect), nil
+	}
+	if !o.Enabled() {
+		return nil, nil, errors.New("htp: tls: no certificate or acme domain set")
+	}
+	cr := &certReloader{certFile: o.CertFile, keyFile: o.KeyFile}
+	if _, err := cr.load(); err != nil {
+		return nil, nil, err
+	}
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"h2", "http/1.1"},
+		GetCertificate: cr.GetCertificate,
+	}
+	return cfg, redirect, nil
+}
+
+func acmeHTTPClient(rootCA string) (*http.Client, error) {
+	if len(rootCA) == 0 {
+		return http.DefaultClient, nil
+	}
+	pem, err := ioutil.ReadFile(rootCA)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("htp: tls: no certificates found in " + rootCA)
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return &http.Client{Transport: tr}, nil
+}
+
+// redirectHTTPS sends the client to the same URL over https on port
+func redirectHTTPS(port int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// certReloader serves a certificate pair from disk and reloads it when either file
+// changes, so that renewed certificates are picked up without a restart
+type certReloader struct {
+	certFile string
+	keyFile  string
+	mtx      sync.Mutex
+	cert     *tls.Certificate
+	modTime  time.Time
+	checked  time.Time
+}
+
+func (c *certReloader) load() (*tls.Certificate, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.cert != nil && time.Since(c.checked) < time.Second {
+		return c.cert, nil
+	}
+	c.checked = time.Now()
+	mod, err := latestModTime(c.certFile, c.keyFile)
+	if err != nil {
+		if c.cert != nil {
+			// keep serving the old pair while files are being replaced
+			return c.cert, nil
+		}
+		return nil, err
+	}
+	if c.cert != nil && !mod.After(c.modTime) {
+		return c.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		if c.cert != nil {
+			return c.cert, nil
+		}
+		return nil, err
+	}
+	c.cert = &cert
+	c.modTime = mod
+	return c.cert, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.load()
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	res := time.Time{}
+	for _, item := range files {
+		s, err := os.Stat(item)
+		if err != nil {
+			return res, err
+		}
+		if s.ModTime().After(res) {
+			res = s.ModTime()
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,134 @@
+package htp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/nektro/go-util/vflag"
+	"github.com/nektro/go.etc/htp/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingOptions configures the OpenTelemetry exporter set up by SetupTracing
+type TracingOptions struct {
+	Exporter    string // 'otlp', 'stdout', or 'file'. Tracing is disabled if empty.
+	Endpoint    string // host:port of an OTLP/HTTP collector, used by 'otlp'
+	Insecure    bool   // connect to Endpoint over http instead of https
+	File        string // path the 'file' exporter appends spans to as json lines
+	ServiceName string // defaults to the name of the executable
+}
+
+// Tracing is the TracingOptions set by flags. etc sets ServiceName to its AppID.
+var Tracing TracingOptions
+
+// tracer makes the spans of every Server
+var tracer = otel.Tracer("github.com/nektro/go.etc/htp")
+
+func tracingPreInit() {
+	vflag.StringVar(&Tracing.Exporter, "trace-exporter", "", "Export OpenTelemetry traces to 'otlp', 'stdout', or 'file'. Leave empty to disable.")
+	vflag.StringVar(&Tracing.Endpoint, "trace-endpoint", "localhost:4318", "host:port of the OTLP/HTTP collector used by --trace-exporter=otlp.")
+	vflag.BoolVar(&Tracing.Insecure, "trace-insecure", false, "Enable this flag to send traces to --trace-endpoint over http.")
+	vflag.StringVar(&Tracing.File, "trace-file", "traces.json", "File used by --trace-exporter=file.")
+}
+
+// SetupTracing installs a global OpenTelemetry tracer provider that exports to
+// opts.Exporter, and the W3C traceparent propagator. The returned function
+// flushes pending spans and should be run when the app stops.
+func SetupTracing(opts TracingOptions) (func() error, error) {
+	var exp sdktrace.SpanExporter
+	var err error
+	var closeFile func() error
+	switch opts.Exporter {
+	case "otlp":
+		o := []otlptracehttp.Option{otlptracehttp.WithEndpoint(opts.Endpoint)}
+		if opts.Insecure {
+			o = append(o, otlptracehttp.WithInsecure())
+		}
+		exp, err = otlptracehttp.New(context.Background(), o...)
+	case "stdout":
+		exp, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case "file":
+		f, ferr := os.OpenFile(opts.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if ferr != nil {
+			return nil, ferr
+		}
+		closeFile = f.Close
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(f))
+	default:
+		return nil, errors.New("htp: unknown trace exporter: " + opts.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+	name := opts.ServiceName
+	if len(name) == 0 {
+		name = os.Args[0]
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", name),
+		attribute.String("service.version", Version),
+	))
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return func() error {
+		err := tp.Shutdown(context.Background())
+		if closeFile != nil {
+			closeFile()
+		}
+		return err
+	}, nil
+}
+
+// trace wraps h to run in a span named after route, the mux path template. The
+// span continues the trace in the request's traceparent header, if it has one.
+func (s *Server) trace(route string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("client.address", middleware.ClientIP(r).String()),
+			),
+		)
+		defer span.End()
+
+		rec := middleware.Record(w)
+		h.ServeHTTP(rec, r.WithContext(ctx))
+		status := rec.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, strconv.Itoa(status))
+		}
+	})
+}
+
+// Context returns the context of this request, which holds its trace span
+func (v *Controller) Context() context.Context {
+	return v.r.Context()
+}
+
+// Span returns the trace span of this request, which is a no-op span if tracing is disabled
+func (v *Controller) Span() trace.Span {
+	return trace.SpanFromContext(v.r.Context())
+}
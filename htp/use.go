@@ -0,0 +1,30 @@
+package htp
+
+import (
+	"net/http"
+)
+
+// Middleware wraps a handler to run code before and/or after it
+type Middleware func(http.Handler) http.Handler
+
+// Use adds middleware that runs on every request to the default server, before routing.
+// It must be called after Init and before StartServer.
+func Use(mws ...func(http.Handler) http.Handler) {
+	defaultServer.Use(mws...)
+}
+
+// Use adds middleware that runs on every request to this server, before routing.
+// It must be called before Handler or Serve.
+func (s *Server) Use(mws ...func(http.Handler) http.Handler) {
+	for _, item := range mws {
+		s.middlewares = append(s.middlewares, item)
+	}
+}
+
+// chain wraps h so that the first Middleware in mws runs first
+func chain(h http.Handler, mws []Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
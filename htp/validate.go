@@ -0,0 +1,224 @@
+package htp
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// FieldError is a single failed validation rule
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// FieldErrors is the list of every rule that failed in Validate
+type FieldErrors []FieldError
+
+// Error implements the error interface
+func (e FieldErrors) Error() string {
+	arr := []string{}
+	for _, item := range e {
+		arr = append(arr, item.Field+": "+item.Message)
+	}
+	return "validation failed: " + strings.Join(arr, "; ")
+}
+
+// Map returns these errors keyed by field name
+func (e FieldErrors) Map() map[string]string {
+	res := map[string]string{}
+	for _, item := range e {
+		res[item.Field] = item.Message
+	}
+	return res
+}
+
+var (
+	regexCache = map[string]*regexp.Regexp{}
+	regexMtx   = new(sync.Mutex)
+)
+
+// Validate checks v, a struct or pointer to a struct, against the rules in its
+// `validate` struct tags. Supported rules are:
+//
+//	required      value must not be the zero value
+//	min=N, max=N  bounds for numbers, length bounds for strings, slices and maps
+//	oneof=a b c   value must be one of the space separated options
+//	regex=expr    string must match expr, must be the last rule as expr may contain commas
+//
+// Rules other than required apply to zero values too, so a field that may be left
+// out must be a pointer. Nested structs are validated as well. Field names are
+// taken from the `json` tag.
+func Validate(v interface{}) error {
+	errs := FieldErrors{}
+	validateStruct(reflect.ValueOf(v), "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateStruct(v reflect.Value, prefix string, errs *FieldErrors) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := fieldName(f)
+		if name == "-" {
+			continue
+		}
+		fv := v.Field(i)
+		if tag, ok := f.Tag.Lookup("validate"); ok {
+			if msg := validateField(fv, tag); msg != "" {
+				*errs = append(*errs, FieldError{prefix + name, msg})
+				continue
+			}
+		}
+		validateStruct(fv, prefix+name+".", errs)
+	}
+}
+
+func fieldName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+// splitRules returns the rules in a `validate` tag
+func splitRules(tag string) []string {
+	rules := []string{}
+	for len(tag) > 0 {
+		if strings.HasPrefix(tag, "regex=") {
+			rules = append(rules, tag)
+			break
+		}
+		parts := strings.SplitN(tag, ",", 2)
+		rules = append(rules, parts[0])
+		if len(parts) == 1 {
+			break
+		}
+		tag = parts[1]
+	}
+	return rules
+}
+
+// validateField returns a message describing the first failed rule, or "" if all pass
+func validateField(v reflect.Value, tag string) string {
+	for _, item := range splitRules(tag) {
+		if item == "required" {
+			if isEmpty(v) {
+				return "is required"
+			}
+			continue
+		}
+		for (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && !v.IsNil() {
+			v = v.Elem()
+		}
+		if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+			// absent values are only checked by required
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			panic("htp: validate: invalid rule: " + item)
+		}
+		if msg := validateRule(v, kv[0], kv[1]); msg != "" {
+			return msg
+		}
+	}
+	return ""
+}
+
+func validateRule(v reflect.Value, rule, arg string) string {
+	switch rule {
+	case "min", "max":
+		n, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			panic("htp: validate: invalid number: " + arg)
+		}
+		x, isLen := measure(v)
+		if rule == "min" && x < n {
+			if isLen {
+				return "must have a length of at least " + arg
+			}
+			return "must be at least " + arg
+		}
+		if rule == "max" && x > n {
+			if isLen {
+				return "must have a length of at most " + arg
+			}
+			return "must be at most " + arg
+		}
+	case "oneof":
+		s := fmt.Sprint(v.Interface())
+		for _, item := range strings.Fields(arg) {
+			if s == item {
+				return ""
+			}
+		}
+		return "must be one of: " + strings.Join(strings.Fields(arg), ", ")
+	case "regex":
+		if !compileRegex(arg).MatchString(fmt.Sprint(v.Interface())) {
+			return "must match " + arg
+		}
+	default:
+		panic("htp: validate: unknown rule: " + rule)
+	}
+	return ""
+}
+
+// measure returns the value of a number or the length of anything else
+func measure(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), false
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), false
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), false
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), true
+	}
+	panic("htp: validate: min/max not supported on " + v.Kind().String())
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+func compileRegex(expr string) *regexp.Regexp {
+	regexMtx.Lock()
+	defer regexMtx.Unlock()
+
+	re, ok := regexCache[expr]
+	if !ok {
+		re = regexp.MustCompile(expr)
+		regexCache[expr] = re
+	}
+	return re
+}
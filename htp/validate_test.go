@@ -0,0 +1,67 @@
+package htp
+
+import (
+	"reflect"
+	"testing"
+)
+
+type validateItem struct {
+	Qty   int      `json:"qty" validate:"min=1,max=10"`
+	Name  string   `json:"name" validate:"required,min=3"`
+	Kind  string   `json:"kind" validate:"oneof=a b"`
+	Code  string   `json:"code" validate:"regex=^[a-z]{1,3}$"`
+	Note  *string  `json:"note" validate:"min=3"`
+	Tags  []string `json:"tags" validate:"max=2"`
+	Inner struct {
+		ID *int `json:"id" validate:"required"`
+	} `json:"inner"`
+}
+
+func TestValidate(t *testing.T) {
+	id, short, long := 1, "ab", "abc"
+	valid := func() validateItem {
+		v := validateItem{Qty: 1, Name: "abc", Kind: "a", Code: "x"}
+		v.Inner.ID = &id
+		return v
+	}
+	cases := []struct {
+		name string
+		edit func(v *validateItem)
+		want map[string]string
+	}{
+		{"valid", func(v *validateItem) {}, nil},
+		{"zero number is checked", func(v *validateItem) { v.Qty = 0 }, map[string]string{"qty": "must be at least 1"}},
+		{"max", func(v *validateItem) { v.Qty = 11 }, map[string]string{"qty": "must be at most 10"}},
+		{"required", func(v *validateItem) { v.Name = "" }, map[string]string{"name": "is required"}},
+		{"string length", func(v *validateItem) { v.Name = "ab" }, map[string]string{"name": "must have a length of at least 3"}},
+		{"empty oneof is checked", func(v *validateItem) { v.Kind = "" }, map[string]string{"kind": "must be one of: a, b"}},
+		{"regex", func(v *validateItem) { v.Code = "ABCD" }, map[string]string{"code": "must match ^[a-z]{1,3}$"}},
+		{"empty regex is checked", func(v *validateItem) { v.Code = "" }, map[string]string{"code": "must match ^[a-z]{1,3}$"}},
+		{"nil pointer is skipped", func(v *validateItem) { v.Note = nil }, nil},
+		{"pointer is checked", func(v *validateItem) { v.Note = &short }, map[string]string{"note": "must have a length of at least 3"}},
+		{"pointer passes", func(v *validateItem) { v.Note = &long }, nil},
+		{"slice length", func(v *validateItem) { v.Tags = []string{"a", "b", "c"} }, map[string]string{"tags": "must have a length of at most 2"}},
+		{"nested", func(v *validateItem) { v.Inner.ID = nil }, map[string]string{"inner.id": "is required"}},
+		{"several", func(v *validateItem) { v.Qty, v.Name = 0, "" }, map[string]string{"qty": "must be at least 1", "name": "is required"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			v := valid()
+			tc.edit(&v)
+			err := Validate(&v)
+			if tc.want == nil {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			fe, ok := err.(FieldErrors)
+			if !ok {
+				t.Fatalf("Validate() = %v, want FieldErrors", err)
+			}
+			if got := fe.Map(); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Validate() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
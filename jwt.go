@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/nektro/go.etc/htp"
+	"github.com/nektro/go.etc/htp/middleware"
 	"github.com/nektro/go.etc/jwt"
 
 	. "github.com/nektro/go-util/alias"
@@ -24,10 +25,17 @@ func JWTSet(w http.ResponseWriter, sub string) {
 // JWTGetClaims reads the 'jwt' cookie and returns claims within it, if they are valid
 func JWTGetClaims(c *htp.Controller, r *http.Request) jwt.MapClaims {
 	clms, err := jwt.VerifyRequest(r, JWTSecret)
-	c.Assert(err == nil, "403: "+F("%v", err))
+	c.AssertStatus(err == nil, http.StatusForbidden, F("%v", err))
+	sub, _ := clms["sub"].(string)
+	middleware.SetSubject(r, sub)
 	return clms
 }
 
+// JWTRequire returns htp middleware that rejects requests without a valid 'jwt'
+func JWTRequire() htp.Middleware {
+	return htp.RequireJWT(JWTSecret)
+}
+
 // JWTDestroy tells the ResponseWriter to delete the 'jwt' cookie
 func JWTDestroy(w http.ResponseWriter) {
 	http.SetCookie(w, &http.Cookie{
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"net/http"
 	"strings"
 
 	"github.com/nektro/go.etc/htp"
@@ -17,7 +18,7 @@ func PgpEncrypt(c *htp.Controller, message string, keys ...string) string {
 	for _, item := range keys {
 		block, err := armor.Decode(strings.NewReader(item))
 		c.AssertNilErr(err)
-		c.Assert(block.Type == openpgp.PublicKeyType, "403: pgp block must be a public key")
+		c.AssertStatus(block.Type == openpgp.PublicKeyType, http.StatusForbidden, "pgp block must be a public key")
 		keyEnt, err := openpgp.ReadEntity(packet.NewReader(block.Body))
 		c.AssertNilErr(err)
 		recs = append(recs, keyEnt)
@@ -38,7 +39,7 @@ func PgpEncrypt(c *htp.Controller, message string, keys ...string) string {
 func PgpPubKeyFingerprint(c *htp.Controller, keyText string) string {
 	block, err := armor.Decode(strings.NewReader(keyText))
 	c.AssertNilErr(err)
-	c.Assert(block.Type == openpgp.PublicKeyType, "403: pgp block must be a public key")
+	c.AssertStatus(block.Type == openpgp.PublicKeyType, http.StatusForbidden, "pgp block must be a public key")
 	keyEnt, err := openpgp.ReadEntity(packet.NewReader(block.Body))
 	c.AssertNilErr(err)
 	finger := fmt.Sprintf("%X", keyEnt.PrimaryKey.Fingerprint[:])
@@ -1,6 +1,7 @@
 package redis
 
 import (
+	"io"
 	"time"
 
 	"github.com/bsm/redislock"
@@ -39,6 +40,11 @@ func (p *Store) Ping() error {
 	return err
 }
 
+// Close closes the connection to this store
+func (p *Store) Close() error {
+	return p.c.Close()
+}
+
 // Has tests whether this Store contains a certain key
 func (p *Store) Has(key string) bool {
 	n, _ := p.c.Exists(key).Result()
@@ -50,6 +56,11 @@ func (p *Store) Set(key string, val string) {
 	p.c.Set(key, val, 0).Err()
 }
 
+// SetExpire sets the value of a single key, which is removed after ttl
+func (p *Store) SetExpire(key string, val string, ttl time.Duration) {
+	p.c.Set(key, val, ttl).Err()
+}
+
 // Get retrieves the value of a single key
 func (p *Store) Get(key string) string {
 	s, _ := p.c.Get(key).Result()
@@ -130,3 +141,26 @@ func (p *Store) Unlock() {
 	p.k.Release()
 	p.k = nil
 }
+
+// Eval runs a Lua script on the server with the keys and args it reads
+func (p *Store) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	return p.c.Eval(script, keys, args...).Result()
+}
+
+// Publish sends message to every subscriber of channel
+func (p *Store) Publish(channel, message string) error {
+	return p.c.Publish(channel, message).Err()
+}
+
+// Subscribe returns the messages sent to channel until the io.Closer is closed
+func (p *Store) Subscribe(channel string) (<-chan string, io.Closer) {
+	ps := p.c.Subscribe(channel)
+	res := make(chan string)
+	go func() {
+		defer close(res)
+		for m := range ps.Channel() {
+			res <- m.Payload
+		}
+	}()
+	return res, ps
+}
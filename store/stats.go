@@ -0,0 +1,99 @@
+package store
+
+import (
+	"sync/atomic"
+)
+
+// ops counts the calls made through Store, by operation
+var ops = map[string]*uint64{}
+
+func init() {
+	for _, item := range []string{"has", "set", "get", "rem", "range", "has_list", "list_has", "list_add", "list_remove", "list_len", "list_get", "lock"} {
+		ops[item] = new(uint64)
+	}
+}
+
+// OpCounts returns the number of calls made through Store, by operation
+func OpCounts() map[string]uint64 {
+	res := map[string]uint64{}
+	for k, v := range ops {
+		res[k] = atomic.LoadUint64(v)
+	}
+	return res
+}
+
+func count(op string) {
+	atomic.AddUint64(ops[op], 1)
+}
+
+// Has implements Inner
+func (p Store) Has(key string) bool {
+	count("has")
+	return p.Inner.Has(key)
+}
+
+// Set implements Inner
+func (p Store) Set(key string, val string) {
+	count("set")
+	p.Inner.Set(key, val)
+}
+
+// Get implements Inner
+func (p Store) Get(key string) string {
+	count("get")
+	return p.Inner.Get(key)
+}
+
+// Rem implements Inner
+func (p Store) Rem(key string) {
+	count("rem")
+	p.Inner.Rem(key)
+}
+
+// Range implements Inner
+func (p Store) Range(f func(key string, val string) bool) {
+	count("range")
+	p.Inner.Range(f)
+}
+
+// HasList implements Inner
+func (p Store) HasList(key string) bool {
+	count("has_list")
+	return p.Inner.HasList(key)
+}
+
+// ListHas implements Inner
+func (p Store) ListHas(key, value string) bool {
+	count("list_has")
+	return p.Inner.ListHas(key, value)
+}
+
+// ListAdd implements Inner
+func (p Store) ListAdd(key, value string) {
+	count("list_add")
+	p.Inner.ListAdd(key, value)
+}
+
+// ListRemove implements Inner
+func (p Store) ListRemove(key, value string) {
+	count("list_remove")
+	p.Inner.ListRemove(key, value)
+}
+
+// ListLen implements Inner
+func (p Store) ListLen(key string) int {
+	count("list_len")
+	return p.Inner.ListLen(key)
+}
+
+// ListGet implements Inner
+func (p Store) ListGet(key string) []string {
+	count("list_get")
+	return p.Inner.ListGet(key)
+}
+
+// Lock implements Inner
+func (p Store) Lock() {
+	count("lock")
+	p.Inner.Lock()
+}
@@ -1,7 +1,9 @@
 package store
 
 import (
+	"io"
 	"sync"
+	"time"
 
 	"github.com/nektro/go-util/util"
 	"github.com/nektro/go.etc/store/local"
@@ -32,6 +34,25 @@ func Init(typ string, urlS string) {
 	This = &Store{doInit()}
 }
 
+// Ping checks the connection to the datastore, if it has been set up
+func Ping() error {
+	if This == nil {
+		return nil
+	}
+	return This.Ping()
+}
+
+// Close releases the connection held by the datastore, if it has one
+func Close() error {
+	if This == nil {
+		return nil
+	}
+	if c, ok := This.Inner.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
 func ensureStore() {
 	util.Log("etc:", "store:", This.Type())
 	util.DieOnError(This.Ping())
@@ -55,6 +76,22 @@ type Inner interface {
 	sync.Locker
 }
 
+// PubSub is implemented by Inner types that can pass messages between app instances
+type PubSub interface {
+	Publish(channel, message string) error
+	Subscribe(channel string) (<-chan string, io.Closer)
+}
+
+// Scripter is implemented by Inner types that can run a Lua script atomically
+type Scripter interface {
+	Eval(script string, keys []string, args ...interface{}) (interface{}, error)
+}
+
+// Expirer is implemented by Inner types that can remove a key after a time
+type Expirer interface {
+	SetExpire(key string, val string, ttl time.Duration)
+}
+
 // Store is
 type Store struct {
 	Inner